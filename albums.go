@@ -0,0 +1,181 @@
+package gpm
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// albumBatchSize is the most media keys sent in a single album request
+const albumBatchSize = 500
+
+// DefaultAlbumTemplate names each album after the folder its files came from
+const DefaultAlbumTemplate = "{parent}"
+
+// AlbumGroup is an album to create and the media that goes into it
+type AlbumGroup struct {
+	Name      string
+	MediaKeys []string
+}
+
+// AlbumMapper groups uploaded files into albums named from their source folder.
+// Templates may use these placeholders:
+//
+//	{parent}   name of the folder containing the file
+//	{relpath}  folder relative to the upload root, e.g. "2023/Summer Trip"
+//	{root}     name of the upload root folder
+//
+// Files directly inside a root get the root's name for {parent} and {relpath}.
+type AlbumMapper struct {
+	template string
+	roots    []string // Absolute upload roots, longest first
+
+	mu     sync.Mutex
+	groups map[string]*AlbumGroup
+	order  []string // Album names in first-seen order
+}
+
+// NewAlbumMapper creates a mapper for files uploaded from roots
+// An empty template uses DefaultAlbumTemplate
+func NewAlbumMapper(template string, roots []string) (*AlbumMapper, error) {
+	if template == "" {
+		template = DefaultAlbumTemplate
+	}
+	if !strings.Contains(template, "{parent}") && !strings.Contains(template, "{relpath}") && !strings.Contains(template, "{root}") {
+		return nil, fmt.Errorf("album template %q has no {parent}, {relpath} or {root} placeholder", template)
+	}
+
+	abs := make([]string, 0, len(roots))
+	for _, root := range roots {
+		dir, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", root, err)
+		}
+		abs = append(abs, dir)
+	}
+	sort.Slice(abs, func(i, j int) bool { return len(abs[i]) > len(abs[j]) })
+
+	return &AlbumMapper{template: template, roots: abs, groups: make(map[string]*AlbumGroup)}, nil
+}
+
+// AlbumName returns the album a file belongs to
+func (m *AlbumMapper) AlbumName(path string) string {
+	// An archive counts as the folder holding its members
+	path = strings.Replace(path, ArchiveSeparator, string(filepath.Separator), 1)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	dir := filepath.Dir(abs)
+
+	root := dir
+	for _, r := range m.roots {
+		if rel, err := filepath.Rel(r, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			root = r
+			break
+		}
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		rel = filepath.Base(root)
+	}
+	return strings.NewReplacer(
+		"{parent}", filepath.Base(dir),
+		"{relpath}", filepath.ToSlash(rel),
+		"{root}", filepath.Base(root),
+	).Replace(m.template)
+}
+
+// Add records an uploaded file under its album
+func (m *AlbumMapper) Add(path, mediaKey string) {
+	if mediaKey == "" {
+		return
+	}
+	name := m.AlbumName(path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	group, ok := m.groups[name]
+	if !ok {
+		group = &AlbumGroup{Name: name}
+		m.groups[name] = group
+		m.order = append(m.order, name)
+	}
+	group.MediaKeys = append(group.MediaKeys, mediaKey)
+}
+
+// Groups returns the albums collected so far in the order they were first seen
+func (m *AlbumMapper) Groups() []AlbumGroup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	groups := make([]AlbumGroup, 0, len(m.order))
+	for _, name := range m.order {
+		g := m.groups[name]
+		groups = append(groups, AlbumGroup{Name: g.Name, MediaKeys: append([]string(nil), g.MediaKeys...)})
+	}
+	return groups
+}
+
+// AlbumAddError reports the media that couldn't be added to an album that was created
+type AlbumAddError struct {
+	Album     string
+	MediaKeys []string // Items left out of the album
+	Err       error
+}
+
+func (e *AlbumAddError) Error() string {
+	return fmt.Sprintf("failed to add %d items to album %s: %v", len(e.MediaKeys), e.Album, e.Err)
+}
+
+func (e *AlbumAddError) Unwrap() error {
+	return e.Err
+}
+
+// CreateAlbumWithMedia creates an album holding any number of media items
+// The album is created with the first batch and the rest are added afterwards. A
+// batch that can't be added doesn't stop the others; the album key is returned
+// with an *AlbumAddError listing what is missing.
+func (g *GooglePhotosAPI) CreateAlbumWithMedia(name string, mediaKeys []string) (string, error) {
+	if len(mediaKeys) == 0 {
+		return "", errors.New("an album needs at least one media item")
+	}
+	first := min(albumBatchSize, len(mediaKeys))
+	albumKey, err := g.CreateAlbum(name, mediaKeys[:first])
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	var errs []error
+	for i := first; i < len(mediaKeys); i += albumBatchSize {
+		end := min(i+albumBatchSize, len(mediaKeys))
+		if err := g.AddMediaToAlbum(albumKey, mediaKeys[i:end]); err != nil {
+			missing = append(missing, mediaKeys[i:end]...)
+			errs = append(errs, err)
+		}
+	}
+	if len(missing) > 0 {
+		return albumKey, &AlbumAddError{Album: name, MediaKeys: missing, Err: errors.Join(errs...)}
+	}
+	return albumKey, nil
+}
+
+// CreateAlbums creates one album per group and returns the album keys by name
+// Groups that fail are skipped and their errors returned together
+func (g *GooglePhotosAPI) CreateAlbums(groups []AlbumGroup) (map[string]string, error) {
+	albumKeys := make(map[string]string, len(groups))
+	var errs []error
+	for _, group := range groups {
+		albumKey, err := g.CreateAlbumWithMedia(group.Name, group.MediaKeys)
+		if albumKey != "" {
+			albumKeys[group.Name] = albumKey
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("album %s: %w", group.Name, err))
+		}
+	}
+	return albumKeys, errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package gpm
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAlbumMapperAlbumName(t *testing.T) {
+	base := t.TempDir()
+	at := func(rel string) string { return filepath.Join(base, filepath.FromSlash(rel)) }
+
+	tests := []struct {
+		name     string
+		template string
+		roots    []string
+		path     string
+		want     string
+	}{
+		{"parent", "{parent}", []string{"photos"}, "photos/2023/Trip/a.jpg", "Trip"},
+		{"relpath", "{relpath}", []string{"photos"}, "photos/2023/Trip/a.jpg", "2023/Trip"},
+		{"root", "{root}", []string{"photos"}, "photos/2023/Trip/a.jpg", "photos"},
+		{"combined", "{root} - {relpath} ({parent})", []string{"photos"}, "photos/2023/Trip/a.jpg", "photos - 2023/Trip (Trip)"},
+		{"default template", "", []string{"photos"}, "photos/2023/Trip/a.jpg", "Trip"},
+		{"file in the root", "{parent}|{relpath}|{root}", []string{"photos"}, "photos/a.jpg", "photos|photos|photos"},
+		{"nested roots use the closest", "{relpath}|{root}", []string{"photos", "photos/2023"}, "photos/2023/Trip/a.jpg", "Trip|2023"},
+		{"nested roots in any order", "{relpath}|{root}", []string{"photos/2023", "photos"}, "photos/2023/Trip/a.jpg", "Trip|2023"},
+		{"outer root outside the nested one", "{relpath}|{root}", []string{"photos", "photos/2023"}, "photos/2024/a.jpg", "2024|photos"},
+		{"name prefix is not a parent", "{relpath}|{root}", []string{"photos"}, "photos2/Trip/a.jpg", "Trip|Trip"},
+		{"outside every root", "{relpath}|{root}", []string{"photos"}, "other/Trip/a.jpg", "Trip|Trip"},
+		{"archive member", "{parent}", []string{"photos"}, "photos/backup.zip" + ArchiveSeparator + "2021/Beach/a.jpg", "Beach"},
+		{"archive member relpath", "{relpath}", []string{"photos"}, "photos/backup.zip" + ArchiveSeparator + "2021/a.jpg", "backup.zip/2021"},
+		{"archive as the root", "{relpath}|{root}", []string{"photos/backup.zip"}, "photos/backup.zip" + ArchiveSeparator + "a.jpg", "backup.zip|backup.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots := make([]string, len(tt.roots))
+			for i, root := range tt.roots {
+				roots[i] = at(root)
+			}
+			m, err := NewAlbumMapper(tt.template, roots)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.AlbumName(at(tt.path)); got != tt.want {
+				t.Errorf("AlbumName(%s) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAlbumMapperTemplate(t *testing.T) {
+	if _, err := NewAlbumMapper("Holiday", nil); err == nil {
+		t.Error("no error for a template without placeholders")
+	}
+}
+
+func TestAlbumMapperGroups(t *testing.T) {
+	base := t.TempDir()
+	m, err := NewAlbumMapper("{parent}", []string{base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Add(filepath.Join(base, "Trip", "a.jpg"), "key-a")
+	m.Add(filepath.Join(base, "Home", "b.jpg"), "key-b")
+	m.Add(filepath.Join(base, "Trip", "a.mov"), "key-a-video")
+	m.Add(filepath.Join(base, "Trip", "c.jpg"), "") // Not in the library
+
+	groups := m.Groups()
+	want := []AlbumGroup{
+		{Name: "Trip", MediaKeys: []string{"key-a", "key-a-video"}},
+		{Name: "Home", MediaKeys: []string{"key-b"}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("Groups() = %v, want %v", groups, want)
+	}
+	for i := range want {
+		if groups[i].Name != want[i].Name || len(groups[i].MediaKeys) != len(want[i].MediaKeys) {
+			t.Errorf("group %d = %v, want %v", i, groups[i], want[i])
+			continue
+		}
+		for j := range want[i].MediaKeys {
+			if groups[i].MediaKeys[j] != want[i].MediaKeys[j] {
+				t.Errorf("group %d = %v, want %v", i, groups[i], want[i])
+			}
+		}
+	}
+}
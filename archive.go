@@ -0,0 +1,184 @@
+package gpm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ArchiveSeparator separates the path of an archive from the path of a member in
+// event paths, as in "backup.zip!/2021/IMG_0001.JPG"
+const ArchiveSeparator = "!/"
+
+// archiveMember is a regular file inside an archive. Archives are read front to
+// back, so whoever is handed a member closes done once it has read r, and the
+// walker's found callback doesn't return before that.
+type archiveMember struct {
+	r         io.Reader // Content, valid until done is closed
+	size      int64
+	modTime   time.Time
+	mediaType string // Sniffed from the content, "" if it isn't recognised
+	done      chan struct{}
+}
+
+// isArchive reports whether path names a zip or (gzipped) tar archive by its extension
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isArchiveMember reports whether path names a member of an archive, see ArchiveSeparator
+func isArchiveMember(path string) bool {
+	archive, _, ok := strings.Cut(path, ArchiveSeparator)
+	return ok && isArchive(archive)
+}
+
+// archiveMembers groups the paths of archive members, "backup.zip!/IMG_0001.JPG",
+// by the archive they are in
+func archiveMembers(paths []string) map[string]map[string]bool {
+	members := make(map[string]map[string]bool)
+	for _, p := range paths {
+		if !isArchiveMember(p) {
+			continue
+		}
+		archive, name, _ := strings.Cut(p, ArchiveSeparator)
+		if info, err := os.Stat(archive); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if members[archive] == nil {
+			members[archive] = make(map[string]bool)
+		}
+		members[archive][memberName(name)] = true
+	}
+	return members
+}
+
+// memberName cleans the path of an archive member, which may start with "/" or "./"
+func memberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// walkArchive streams the members of an archive like the files of a directory,
+// only those named in only if it is set. Members are reported under the archive
+// path, see ArchiveSeparator.
+func (w *walker) walkArchive(archive string, only map[string]bool, found func(walkedFile) bool, onError func(string, error)) bool {
+	var ok bool
+	var err error
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		ok, err = w.walkZip(archive, only, found, onError)
+	} else {
+		ok, err = w.walkTar(archive, only, found, onError)
+	}
+	if err != nil {
+		onError(archive, fmt.Errorf("error reading archive: %w", err))
+	}
+	return ok
+}
+
+func (w *walker) walkZip(archive string, only map[string]bool, found func(walkedFile) bool, onError func(string, error)) (bool, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return true, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() || (only != nil && !only[memberName(f.Name)]) {
+			continue
+		}
+		open := func() (io.ReadCloser, error) { return f.Open() }
+		if !w.member(archive, f.Name, int64(f.UncompressedSize64), f.Modified, open, found, onError) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (w *walker) walkTar(archive string, only map[string]bool, found func(walkedFile) bool, onError func(string, error)) (bool, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return true, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if lower := strings.ToLower(archive); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return true, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		if !header.FileInfo().Mode().IsRegular() || (only != nil && !only[memberName(header.Name)]) {
+			continue
+		}
+		// The tar stream is only valid until the next header is read
+		open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if !w.member(archive, header.Name, header.Size, header.ModTime, open, found, onError) {
+			return false, nil
+		}
+	}
+}
+
+// member filters one archive member and reports it, returning false to stop the walk.
+// Its type is sniffed from the leading bytes, as for files on disk.
+func (w *walker) member(archive, name string, size int64, modTime time.Time, open func() (io.ReadCloser, error), found func(walkedFile) bool, onError func(string, error)) bool {
+	root := archive + strings.TrimSuffix(ArchiveSeparator, "/")
+	memberPath := archive + ArchiveSeparator + memberName(name)
+	if w.filter != nil {
+		if reason := w.filter.unincluded(root, memberPath); reason != "" {
+			w.skip(memberPath, reason)
+			return true
+		}
+		if w.filter.excludedWithParents(root, memberPath) {
+			w.skip(memberPath, "excluded")
+			return true
+		}
+	}
+
+	rc, err := open()
+	if err != nil {
+		onError(memberPath, fmt.Errorf("error reading archive member: %w", err))
+		return true
+	}
+	defer rc.Close()
+	r := bufio.NewReaderSize(rc, sniffLen)
+	header, err := r.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		onError(memberPath, fmt.Errorf("error reading archive member: %w", err))
+		return true
+	}
+	mediaType, ok := resolveHeaderMediaType(memberPath, header)
+	if !ok && w.filter != nil && !w.filter.disableFilter {
+		w.skip(memberPath, "unsupported file type")
+		return true
+	}
+	return found(walkedFile{
+		root:   root,
+		path:   memberPath,
+		member: &archiveMember{r: r, size: size, modTime: modTime, mediaType: mediaType, done: make(chan struct{})},
+	})
+}
@@ -0,0 +1,137 @@
+package gpm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWalkerArchiveMembers(t *testing.T) {
+	jpeg := "\xFF\xD8\xFF\xE0jpeg"
+	members := []struct {
+		name, content string
+	}{
+		{"photos/IMG_0001.jpg", jpeg},
+		{"photos/renamed.dat", jpeg},
+		{"photos/notes.jpg", "not a photo"},
+		{"photos/clip.mts", "no signature"},
+		{"photos/readme.txt", "text"},
+	}
+	tests := []struct {
+		name    string
+		filter  UploadOptions
+		want    map[string]string // Member to its sniffed media type
+		skipped map[string]string // Member to the reason
+	}{
+		{
+			name: "sniffed",
+			want: map[string]string{
+				"photos/IMG_0001.jpg": "image/jpeg",
+				"photos/renamed.dat":  "image/jpeg",
+				"photos/clip.mts":     "video/mp2t",
+			},
+			skipped: map[string]string{
+				"photos/notes.jpg":  "unsupported file type",
+				"photos/readme.txt": "unsupported file type",
+			},
+		},
+		{
+			name:   "included",
+			filter: UploadOptions{Include: []string{"*.jpg"}},
+			want:   map[string]string{"photos/IMG_0001.jpg": "image/jpeg"},
+			skipped: map[string]string{
+				"photos/renamed.dat": "not matched by include patterns",
+				"photos/notes.jpg":   "unsupported file type",
+				"photos/clip.mts":    "not matched by include patterns",
+				"photos/readme.txt":  "not matched by include patterns",
+			},
+		},
+		{
+			name:   "unfiltered",
+			filter: UploadOptions{DisableFilter: true},
+			want: map[string]string{
+				"photos/IMG_0001.jpg": "image/jpeg",
+				"photos/renamed.dat":  "image/jpeg",
+				"photos/notes.jpg":    "",
+				"photos/clip.mts":     "video/mp2t",
+				"photos/readme.txt":   "",
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "backup.zip")
+	tarPath := filepath.Join(dir, "backup.tar")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarFile, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw, tw := zip.NewWriter(zipFile), tar.NewWriter(tarFile)
+	for _, m := range members {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, m.content)
+		tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.content)), ModTime: time.Now(), Typeflag: tar.TypeReg})
+		io.WriteString(tw, m.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipFile.Close()
+	tarFile.Close()
+
+	for _, archive := range []string{zipPath, tarPath} {
+		for _, tt := range tests {
+			t.Run(filepath.Base(archive)+"/"+tt.name, func(t *testing.T) {
+				filter, err := newPathFilter(tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w := newWalker(filter, tt.filter)
+				skipped := make(map[string]string)
+				w.skipped = func(path, reason string) { skipped[path] = reason }
+
+				got := make(map[string]string)
+				w.walk([]string{archive}, func(file walkedFile) bool {
+					if file.member == nil {
+						t.Fatalf("%s is not a member", file.path)
+					}
+					got[file.path] = file.member.mediaType
+					// The sniffed header is still part of the content
+					if data, err := io.ReadAll(file.member.r); err != nil || len(data) != int(file.member.size) {
+						t.Errorf("%s: read %d bytes (%v), want %d", file.path, len(data), err, file.member.size)
+					}
+					return true
+				}, func(path string, err error) { t.Errorf("%s: %v", path, err) })
+
+				if len(got) != len(tt.want) {
+					t.Errorf("walk found %v, want %v", got, tt.want)
+				}
+				for name, mediaType := range tt.want {
+					path := archive + ArchiveSeparator + name
+					if mt, ok := got[path]; !ok || mt != mediaType {
+						t.Errorf("%s: media type %q (found %v), want %q", name, mt, ok, mediaType)
+					}
+				}
+				for name, reason := range tt.skipped {
+					if r := skipped[archive+ArchiveSeparator+name]; r != reason {
+						t.Errorf("%s: skipped for %q, want %q", name, r, reason)
+					}
+				}
+			})
+		}
+	}
+}
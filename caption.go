@@ -0,0 +1,163 @@
+package gpm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// CaptionTemplate is a text/template evaluated per file to produce its caption.
+// Templates are executed with a *CaptionData, for example:
+//
+//	{{.Folder}} – {{.Camera}}
+//	{{with .Sidecar}}{{.}}{{else}}{{.Filename}}{{end}}
+//	{{if not .Date.IsZero}}{{.Date.Format "2 Jan 2006"}}{{end}}
+//
+// Text without actions is used as is.
+type CaptionTemplate struct {
+	text string
+	tmpl *template.Template // nil for literal captions
+}
+
+// ParseCaptionTemplate parses a caption template
+func ParseCaptionTemplate(text string) (*CaptionTemplate, error) {
+	c := &CaptionTemplate{text: text}
+	if !strings.Contains(text, "{{") {
+		return c, nil
+	}
+	tmpl, err := template.New("caption").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid caption template: %w", err)
+	}
+	c.tmpl = tmpl
+	return c, nil
+}
+
+// newCaption parses opts.Caption, nil if no caption is set
+func newCaption(opts UploadOptions) (*CaptionTemplate, error) {
+	if opts.Caption == "" {
+		return nil, nil
+	}
+	return ParseCaptionTemplate(opts.Caption)
+}
+
+// newVideoCaption parses the caption template of Live Photo video halves, nil if unset
+func newVideoCaption(opts UploadOptions) (*CaptionTemplate, error) {
+	if opts.LivePhotos == nil || opts.LivePhotos.VideoCaption == "" {
+		return nil, nil
+	}
+	return ParseCaptionTemplate(opts.LivePhotos.VideoCaption)
+}
+
+// Caption returns the caption for data, trimmed of surrounding whitespace
+func (c *CaptionTemplate) Caption(data *CaptionData) (string, error) {
+	if c.tmpl == nil {
+		return c.text, nil
+	}
+	var b strings.Builder
+	if err := c.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("caption template: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// CaptionData describes the file a caption is made for. Metadata and the sidecar
+// are only read when the template uses them.
+type CaptionData struct {
+	Filename string // Base name, e.g. "IMG_0001.jpg"
+	RelPath  string // Path relative to the upload root, e.g. "2023/Summer/IMG_0001.jpg"
+	Folder   string // Name of the folder containing the file
+
+	path    string // File to read metadata from
+	sidecar string // Path the sidecar is looked up next to, empty if there is none
+	meta    *MediaMetadata
+	text    *string
+}
+
+// NewCaptionData describes the file at path, found under the upload root
+func NewCaptionData(path, root string) *CaptionData {
+	rel := filepath.Base(path)
+	if root != "" {
+		if r, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+		}
+	}
+	return &CaptionData{
+		Filename: filepath.Base(path),
+		RelPath:  filepath.ToSlash(rel),
+		Folder:   filepath.Base(filepath.Dir(path)),
+		path:     path,
+		sidecar:  path,
+	}
+}
+
+// captionData describes an upload item, reading content from its local copy
+func captionData(item uploadItem) *CaptionData {
+	if item.root != "" {
+		data := NewCaptionData(item.source, item.root)
+		data.path = item.path // A temp copy for archive members
+		return data
+	}
+	// Not from the filesystem, only the name is known
+	name := item.name
+	if name == "" {
+		name = filepath.Base(item.source)
+	}
+	return &CaptionData{Filename: name, RelPath: name, path: item.path}
+}
+
+func (d *CaptionData) metadata() *MediaMetadata {
+	if d.meta == nil {
+		d.meta = &MediaMetadata{}
+		if meta, err := ReadMediaMetadata(d.path); err == nil {
+			d.meta = meta
+		}
+	}
+	return d.meta
+}
+
+// Date returns the embedded capture time, zero if the file has none
+func (d *CaptionData) Date() time.Time {
+	return d.metadata().CaptureTime
+}
+
+// Make returns the camera manufacturer
+func (d *CaptionData) Make() string {
+	return d.metadata().Make
+}
+
+// Model returns the camera model
+func (d *CaptionData) Model() string {
+	return d.metadata().Model
+}
+
+// Camera returns make and model, without the make twice when the model repeats it
+func (d *CaptionData) Camera() string {
+	maker, model := d.Make(), d.Model()
+	if maker == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(maker)) {
+		return model
+	}
+	return strings.TrimSpace(maker + " " + model)
+}
+
+// Sidecar returns the trimmed content of "IMG_0001.jpg.txt" or else "IMG_0001.txt"
+// next to the file, empty if there is neither
+func (d *CaptionData) Sidecar() string {
+	if d.text != nil {
+		return *d.text
+	}
+	text := ""
+	if d.sidecar != "" {
+		for _, p := range []string{d.sidecar + ".txt", strings.TrimSuffix(d.sidecar, filepath.Ext(d.sidecar)) + ".txt"} {
+			if data, err := os.ReadFile(p); err == nil {
+				text = strings.TrimSpace(string(data))
+				break
+			}
+		}
+	}
+	d.text = &text
+	return text
+}
@@ -0,0 +1,86 @@
+package gpm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaptionTemplate(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "2023", "Summer", "IMG_0001.jpg")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("\xFF\xD8\xFF\xE0jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "IMG_0001.txt"), []byte("  At the beach\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		parseErr bool
+		execErr  bool
+	}{
+		{"literal", "Holiday", "Holiday", false, false},
+		{"literal keeps spaces", " Holiday ", " Holiday ", false, false},
+		{"fields", "{{.Folder}}: {{.Filename}} ({{.RelPath}})", "Summer: IMG_0001.jpg (2023/Summer/IMG_0001.jpg)", false, false},
+		{"sidecar", "{{.Sidecar}}", "At the beach", false, false},
+		{"sidecar fallback", "{{with .Sidecar}}{{.}}{{else}}{{.Filename}}{{end}}", "At the beach", false, false},
+		{"missing metadata", "{{.Camera}}{{if .Date.IsZero}}undated{{end}}", "undated", false, false},
+		{"trimmed", "  {{.Folder}}  ", "Summer", false, false},
+		{"unclosed action", "{{.Folder", "", true, false},
+		{"unknown function", "{{upper .Folder}}", "", true, false},
+		{"unknown field", "{{.Album}}", "", false, true},
+		{"method on a string", "{{.Folder.Year}}", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCaptionTemplate(tt.template)
+			if tt.parseErr {
+				if err == nil {
+					t.Errorf("ParseCaptionTemplate(%q) succeeded, want an error", tt.template)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Caption(NewCaptionData(path, root))
+			if tt.execErr {
+				if err == nil {
+					t.Errorf("Caption() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Caption() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCaptionData(t *testing.T) {
+	tests := []struct {
+		name, path, root, wantRel string
+	}{
+		{"under the root", "/photos/2023/a.jpg", "/photos", "2023/a.jpg"},
+		{"no root", "/photos/2023/a.jpg", "", "a.jpg"},
+		{"outside the root", "/other/a.jpg", "/photos", "a.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewCaptionData(filepath.FromSlash(tt.path), filepath.FromSlash(tt.root))
+			if d.RelPath != tt.wantRel || d.Filename != "a.jpg" {
+				t.Errorf("RelPath, Filename = %q, %q, want %q, a.jpg", d.RelPath, d.Filename, tt.wantRel)
+			}
+		})
+	}
+}
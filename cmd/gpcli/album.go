@@ -26,8 +26,10 @@ func albumCreateAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
@@ -103,8 +105,10 @@ func albumAddAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
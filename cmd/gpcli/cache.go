@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	gpm "github.com/viperadnan-git/go-gpm"
+
+	"github.com/urfave/cli/v3"
+)
+
+// openHashCache loads the hash cache from the configured cache directory
+func openHashCache() (*gpm.HashCache, error) {
+	if err := loadConfig(); err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+	cacheDir := getCacheDir(cfgManager.GetConfig())
+	if cacheDir == "" {
+		return nil, fmt.Errorf("no cache directory available")
+	}
+	return gpm.NewHashCache(cacheDir), nil
+}
+
+func cacheInfoAction(ctx context.Context, cmd *cli.Command) error {
+	cache, err := openHashCache()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Hash cache: %s\n", cache.Path())
+	fmt.Printf("  Entries: %d\n", cache.Len())
+	if info, err := os.Stat(cache.Path()); err == nil {
+		fmt.Printf("  Size: %d bytes\n", info.Size())
+	}
+	return nil
+}
+
+func cacheListAction(ctx context.Context, cmd *cli.Command) error {
+	cache, err := openHashCache()
+	if err != nil {
+		return err
+	}
+
+	entries := cache.Entries()
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fmt.Printf("%s\t%s\n", entries[path].DedupKey, path)
+	}
+	return nil
+}
+
+func cachePruneAction(ctx context.Context, cmd *cli.Command) error {
+	cache, err := openHashCache()
+	if err != nil {
+		return err
+	}
+
+	removed := cache.Prune()
+	if err := cache.Save(); err != nil {
+		return err
+	}
+	logger.Info("hash cache pruned", "removed", removed, "remaining", cache.Len())
+	return nil
+}
+
+func cacheClearAction(ctx context.Context, cmd *cli.Command) error {
+	cache, err := openHashCache()
+	if err != nil {
+		return err
+	}
+
+	count := cache.Len()
+	if err := cache.Clear(); err != nil {
+		return err
+	}
+	logger.Info("hash cache cleared", "removed", count)
+	return nil
+}
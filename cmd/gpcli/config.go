@@ -15,12 +15,14 @@ import (
 
 // Config represents the persistent configuration
 type Config struct {
-	Credentials   []string `json:"credentials" koanf:"credentials"`
-	Selected      string   `json:"selected" koanf:"selected"`
-	Proxy         string   `json:"proxy" koanf:"proxy"`
-	UseQuota      bool     `json:"useQuota" koanf:"use_quota"`
-	Quality       string   `json:"quality" koanf:"quality"` // "original" or "storage-saver"
-	UploadThreads int      `json:"uploadThreads" koanf:"upload_threads"`
+	Credentials    []string `json:"credentials" koanf:"credentials"`
+	Selected       string   `json:"selected" koanf:"selected"`
+	Proxy          string   `json:"proxy" koanf:"proxy"`
+	UseQuota       bool     `json:"useQuota" koanf:"use_quota"`
+	Quality        string   `json:"quality" koanf:"quality"` // "original" or "storage-saver"
+	UploadThreads  int      `json:"uploadThreads" koanf:"upload_threads"`
+	CacheDir       string   `json:"cacheDir" koanf:"cache_dir"` // Defaults to the user cache directory
+	BandwidthLimit string   `json:"bwlimit" koanf:"bwlimit"`    // e.g. "2M", "512K:10M" or "08:00,2M 19:00,off"
 }
 
 // DefaultConfig returns the default configuration values
@@ -25,8 +25,10 @@ func downloadAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
@@ -58,7 +60,7 @@ func downloadAction(ctx context.Context, cmd *cli.Command) error {
 
 	// Download the file
 	logger.Info("downloading", "is_edited", isEdited)
-	savedPath, err := gpm.DownloadFile(downloadURL, outputPath)
+	savedPath, err := apiClient.DownloadURL(downloadURL, outputPath)
 	if err != nil {
 		return err
 	}
@@ -85,8 +87,10 @@ func thumbnailAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
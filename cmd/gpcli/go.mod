@@ -10,6 +10,7 @@ require (
 	github.com/knadh/koanf/v2 v2.3.0
 	github.com/urfave/cli/v3 v3.6.1
 	github.com/viperadnan-git/go-gpm v0.0.0
+	golang.org/x/term v0.38.0
 )
 
 require (
@@ -4,11 +4,13 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
 var configPath string
 var authOverride string
+var bwlimitOverride string
 var cfgManager *ConfigManager
 
 func loadConfig() error {
@@ -39,6 +41,27 @@ func getAuthData(cfg Config) string {
 	return ""
 }
 
+// getCacheDir returns the directory for persistent client state (resumable uploads, file hashes)
+// Falls back to the OS user cache directory when not set in config
+func getCacheDir(cfg Config) string {
+	if cfg.CacheDir != "" {
+		return cfg.CacheDir
+	}
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userCacheDir, "gpcli")
+}
+
+// getBandwidthLimit returns the bandwidth limit from the --bwlimit flag or the config file
+func getBandwidthLimit(cfg Config) string {
+	if bwlimitOverride != "" {
+		return bwlimitOverride
+	}
+	return cfg.BandwidthLimit
+}
+
 // resolveEmailFromArg resolves an email from either an index number (1-based) or email string
 func resolveEmailFromArg(arg string, credentials []string) (string, error) {
 	// Try to parse as number first
@@ -88,6 +111,17 @@ func resolveEmailFromArg(arg string, credentials []string) (string, error) {
 	return "", fmt.Errorf("multiple accounts match '%s': %v - please be more specific", arg, candidates)
 }
 
+// isWithin reports whether path is dir or lies below it
+func isWithin(path, dir string) bool {
+	absPath, err1 := filepath.Abs(path)
+	absDir, err2 := filepath.Abs(dir)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func containsSubstring(str, substr string) bool {
 	strLower := strings.ToLower(str)
 	substrLower := strings.ToLower(substr)
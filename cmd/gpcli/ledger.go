@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gpm "github.com/viperadnan-git/go-gpm"
+)
+
+// failedUpload is an entry of the failed files list written by --failed-file
+type failedUpload struct {
+	Path      string `json:"path"`
+	Error     string `json:"error"`
+	Transient bool   `json:"transient"` // Likely to succeed when replayed
+}
+
+func newFailedUpload(path string, err error) failedUpload {
+	if abs, absErr := filepath.Abs(path); absErr == nil {
+		path = abs
+	}
+	f := failedUpload{Path: path, Transient: gpm.IsTransientError(err)}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	return f
+}
+
+// writeFailedUploads writes the list as JSON if path ends in .json, otherwise as one
+// path per line with the error in a comment above it
+func writeFailedUploads(path string, failures []failedUpload) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if failures == nil {
+			failures = []failedUpload{}
+		}
+		var err error
+		if data, err = json.MarshalIndent(failures, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	} else {
+		var b strings.Builder
+		b.WriteString("# Files that failed to upload, replay with: gpcli upload --from-file " + path + "\n")
+		for _, f := range failures {
+			kind := "permanent"
+			if f.Transient {
+				kind = "transient"
+			}
+			// Keep the comment on one line so the list stays one path per line
+			fmt.Fprintf(&b, "# %s: %s\n%s\n", kind, strings.ReplaceAll(f.Error, "\n", " "), f.Path)
+		}
+		data = []byte(b.String())
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// readUploadList reads the paths of a --failed-file list, or any file with one path per line
+func readUploadList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		var failures []failedUpload
+		if err := json.Unmarshal(data, &failures); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		paths := make([]string, 0, len(failures))
+		for _, f := range failures {
+			paths = append(paths, f.Path)
+		}
+		return paths, nil
+	}
+	return readLinesFromFile(path)
+}
@@ -13,6 +13,7 @@ import (
 var logger *slog.Logger
 var currentLogLevel slog.Level
 var logFormat string
+var logOutput io.Writer = os.Stdout
 
 // humanHandler is a slog.Handler that outputs human-readable logs without timestamps
 type humanHandler struct {
@@ -64,16 +65,22 @@ func initLogger(level slog.Level) {
 	var handler slog.Handler
 	switch logFormat {
 	case "slog":
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(logOutput, opts)
 	case "json":
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(logOutput, opts)
 	default: // "human"
-		handler = &humanHandler{out: os.Stdout, level: level}
+		handler = &humanHandler{out: logOutput, level: level}
 	}
 	logger = slog.New(handler)
 	slog.SetDefault(logger)
 }
 
+// setLogOutput redirects the global logger to w, keeping its level and format
+func setLogOutput(w io.Writer) {
+	logOutput = w
+	initLogger(currentLogLevel)
+}
+
 // initQuietLogger initializes a logger that only shows errors
 func initQuietLogger() {
 	currentLogLevel = slog.LevelError
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	gpm "github.com/viperadnan-git/go-gpm"
 
@@ -43,6 +44,11 @@ func main() {
 				Usage:   "Authentication string (overrides config file)",
 				Sources: cli.EnvVars("GPCLI_AUTH"),
 			},
+			&cli.StringFlag{
+				Name:    "bwlimit",
+				Usage:   "Bandwidth limit, e.g. 2M, 512K:10M (upload:download) or '08:00,2M 19:00,off'",
+				Sources: cli.EnvVars("GPCLI_BWLIMIT"),
+			},
 			&cli.StringFlag{
 				Name:    "log-format",
 				Value:   "human",
@@ -69,16 +75,17 @@ func main() {
 			if auth := cmd.String("auth"); auth != "" {
 				authOverride = strings.TrimSpace(auth)
 			}
+			bwlimitOverride = cmd.String("bwlimit")
 			return ctx, nil
 		},
 		Commands: []*cli.Command{
 			{
 				Name:  "upload",
-				Usage: "Upload a file or directory to Google Photos",
+				Usage: "Upload a file, directory or zip/tar archive to Google Photos",
 				Arguments: []cli.Argument{
 					&cli.StringArg{
 						Name:      "filepath",
-						UsageText: "Path to the file or directory to upload",
+						UsageText: "Path to the file, directory or archive to upload, or - for stdin",
 					},
 				},
 				Flags: []cli.Flag{
@@ -93,30 +100,109 @@ func main() {
 						Value:   3,
 						Usage:   "Number of upload threads",
 					},
+					&cli.IntFlag{
+						Name:  "hash-threads",
+						Usage: "Number of files hashed at once (default: same as --threads, 1 with --hdd)",
+					},
+					&cli.IntFlag{
+						Name:  "check-threads",
+						Value: 1,
+						Usage: "Number of library existence check batches in flight at once",
+					},
+					&cli.IntFlag{
+						Name:  "queue-size",
+						Usage: "Files buffered between pipeline stages (default: same as --threads)",
+					},
+					&cli.BoolFlag{
+						Name:  "hdd",
+						Usage: "Read from disk one file chunk at a time, for spinning disks",
+					},
 					&cli.BoolFlag{
 						Name:    "force",
 						Aliases: []string{"f"},
 						Usage:   "Force upload even if file exists",
 					},
+					&cli.IntFlag{
+						Name:  "retries",
+						Value: 3,
+						Usage: "Retries per file after transient errors (rate limits, server and network errors)",
+					},
+					&cli.DurationFlag{
+						Name:  "retry-delay",
+						Value: 2 * time.Second,
+						Usage: "Wait before the first retry, doubled for each one after",
+					},
+					&cli.StringFlag{
+						Name:  "failed-file",
+						Usage: "Write files that failed to this list, as JSON if it ends in .json (replay with --from-file)",
+					},
+					&cli.StringFlag{
+						Name:    "from-file",
+						Aliases: []string{"i"},
+						Usage:   "Upload the paths listed in this file (one per line, or a JSON list from --failed-file)",
+					},
 					&cli.BoolFlag{
 						Name:    "delete",
 						Aliases: []string{"d"},
-						Usage:   "Delete from host after upload",
+						Usage:   "Delete from host once the upload is verified",
+					},
+					&cli.StringFlag{
+						Name:  "move-to",
+						Usage: "Move files into this directory once the upload is verified, instead of deleting them",
+					},
+					&cli.BoolFlag{
+						Name:  "verify-download",
+						Usage: "With --delete or --move-to, download each item and compare checksums before removing it (original quality only)",
 					},
 					&cli.BoolFlag{
 						Name:  "disable-filter",
 						Usage: "Disable file type filtering",
 					},
+					&cli.StringSliceFlag{
+						Name:  "include",
+						Usage: "Only upload files matching this gitignore-style pattern (repeatable)",
+					},
+					&cli.BoolFlag{
+						Name:    "follow-symlinks",
+						Aliases: []string{"L"},
+						Usage:   "Follow symbolic links to files and directories (links are skipped by default)",
+					},
+					&cli.BoolFlag{
+						Name:  "archives",
+						Usage: "Also upload the members of zip and tar(.gz) archives found in directories (archives given as paths always are)",
+					},
+					&cli.StringFlag{
+						Name:  "temp-dir",
+						Usage: "Directory to spool archive members into (default: system temp directory)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exclude",
+						Usage: "Skip files and directories matching this gitignore-style pattern (repeatable, .gpcliignore files are also honoured)",
+					},
 					&cli.StringFlag{
 						Name:  "album",
 						Usage: "Add uploaded files to album with this name (creates if not exists)",
 					},
+					&cli.BoolFlag{
+						Name:  "album-per-folder",
+						Usage: "Create one album per source folder, named by --album-template",
+					},
+					&cli.StringFlag{
+						Name:  "album-template",
+						Value: gpm.DefaultAlbumTemplate,
+						Usage: "Album name for --album-per-folder: {parent} (folder name), {relpath} (folder relative to the upload root) or {root}",
+					},
 					&cli.StringFlag{
 						Name:    "quality",
 						Aliases: []string{"q"},
 						Value:   "original",
 						Usage:   "Upload quality: 'original' or 'storage-saver'",
 					},
+					&cli.StringFlag{
+						Name:  "timestamp",
+						Value: "mtime",
+						Usage: "Date for uploaded items: 'mtime' (file modification time), 'exif' (embedded capture time) or 'auto' (capture time when plausible)",
+					},
 					&cli.BoolFlag{
 						Name:  "use-quota",
 						Usage: "Uploaded files will count against your Google Photos storage quota",
@@ -128,15 +214,126 @@ func main() {
 					},
 					&cli.StringFlag{
 						Name:  "caption",
-						Usage: "Set caption for uploaded files",
+						Usage: "Caption for uploaded files, a Go template with {{.Filename}}, {{.RelPath}}, {{.Folder}}, {{.Date}}, {{.Make}}, {{.Model}}, {{.Camera}} and {{.Sidecar}} (text of a .txt next to the file)",
 					},
 					&cli.BoolFlag{
 						Name:  "favourite",
 						Usage: "Mark uploaded files as favourites",
 					},
+					&cli.BoolFlag{
+						Name:  "xmp-caption",
+						Usage: "Caption files with the description (or title) from their XMP sidecar or embedded XMP",
+					},
+					&cli.IntFlag{
+						Name:  "xmp-favourite-rating",
+						Usage: "Mark files rated at least this (1-5) in XMP as favourites",
+					},
+					&cli.StringSliceFlag{
+						Name:  "xmp-album",
+						Usage: "Add files to albums by XMP keyword or colour label: keyword:VALUE[=ALBUM] or label:VALUE[=ALBUM], keyword:* for one album per keyword (repeatable)",
+					},
+					&cli.BoolFlag{
+						Name:  "report-duplicates",
+						Usage: "List groups of identical files found while uploading (only one of each is uploaded either way)",
+					},
+					&cli.BoolFlag{
+						Name:  "live-photos",
+						Usage: "Pair Live Photo stills with their videos (IMG_0001.HEIC + IMG_0001.MOV) and upload each pair together",
+					},
+					&cli.StringFlag{
+						Name:  "live-video",
+						Usage: "What to do with the video half of a Live Photo: 'upload', 'archive' or 'skip' (implies --live-photos)",
+					},
+					&cli.StringFlag{
+						Name:  "live-video-caption",
+						Usage: "Caption template for the video half of a Live Photo, same variables as --caption (implies --live-photos)",
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "File name to use when uploading from stdin",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Show what would be uploaded, skipped and filtered without changing anything",
+					},
+					&cli.StringFlag{
+						Name:  "plan-format",
+						Value: "text",
+						Usage: "Output format for --dry-run: 'text' or 'json'",
+					},
+					&cli.BoolFlag{
+						Name:  "no-progress",
+						Usage: "Print plain log lines instead of the live progress display",
+					},
+					&cli.BoolFlag{
+						Name:    "watch",
+						Aliases: []string{"w"},
+						Usage:   "Keep running and upload new files as they appear (stop with Ctrl+C)",
+					},
 				},
 				Action: uploadAction,
 			},
+			{
+				Name:  "import",
+				Usage: "Import exports from other services",
+				Commands: []*cli.Command{
+					{
+						Name:      "takeout",
+						Usage:     "Import a Google Takeout export with its dates, captions, favourites, archive state and albums",
+						UsageText: "gpcli import takeout <dir|zip> [dir|zip...]",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:    "threads",
+								Aliases: []string{"t"},
+								Value:   3,
+								Usage:   "Number of upload threads",
+							},
+							&cli.StringFlag{
+								Name:    "quality",
+								Aliases: []string{"q"},
+								Value:   "original",
+								Usage:   "Upload quality: 'original' or 'storage-saver'",
+							},
+							&cli.BoolFlag{
+								Name:  "use-quota",
+								Usage: "Uploaded files will count against your Google Photos storage quota",
+							},
+							&cli.BoolFlag{
+								Name:    "force",
+								Aliases: []string{"f"},
+								Usage:   "Force upload even if file exists",
+							},
+							&cli.IntFlag{
+								Name:  "retries",
+								Value: 3,
+								Usage: "Retries per file after transient errors (rate limits, server and network errors)",
+							},
+							&cli.DurationFlag{
+								Name:  "retry-delay",
+								Value: 2 * time.Second,
+								Usage: "Wait before the first retry, doubled for each one after",
+							},
+							&cli.StringFlag{
+								Name:  "failed-file",
+								Usage: "Write files that failed to this list, as JSON if it ends in .json",
+							},
+							&cli.BoolFlag{
+								Name:  "no-albums",
+								Usage: "Don't recreate the albums of the export",
+							},
+							&cli.StringFlag{
+								Name:  "temp-dir",
+								Usage: "Directory to spool zip members into (default: system temp directory)",
+							},
+							&cli.BoolFlag{
+								Name:  "no-progress",
+								Usage: "Print plain log lines instead of the live progress display",
+							},
+						},
+						Action: importTakeoutAction,
+					},
+				},
+			},
 			{
 				Name:  "download",
 				Usage: "Download a media item",
@@ -352,6 +549,34 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:   "cache",
+				Usage:  "Inspect and manage the local file hash cache",
+				Action: cacheInfoAction,
+				Commands: []*cli.Command{
+					{
+						Name:   "info",
+						Usage:  "Show cache location and entry count",
+						Action: cacheInfoAction,
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Usage:   "List cached hashes (dedup key and path)",
+						Action:  cacheListAction,
+					},
+					{
+						Name:   "prune",
+						Usage:  "Remove entries for files that were deleted or changed",
+						Action: cachePruneAction,
+					},
+					{
+						Name:   "clear",
+						Usage:  "Remove all cached hashes",
+						Action: cacheClearAction,
+					},
+				},
+			},
 			{
 				Name:  "upgrade",
 				Usage: "Upgrade gpcli to latest or specific version",
@@ -24,8 +24,10 @@ func deleteAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
@@ -66,8 +68,10 @@ func archiveAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
@@ -107,8 +111,10 @@ func favouriteAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
@@ -148,8 +154,10 @@ func captionAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	apiClient, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
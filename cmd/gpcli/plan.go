@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	gpm "github.com/viperadnan-git/go-gpm"
+)
+
+// printPlan writes an upload plan as JSON or as one line per file followed by a summary
+func printPlan(w io.Writer, plan *gpm.UploadPlan, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	for _, f := range plan.Files {
+		line := fmt.Sprintf("%-8s %s", f.Action, f.Path)
+		switch f.Action {
+		case gpm.PlanUpload:
+			line += fmt.Sprintf(" (%s)", formatBytes(f.Size))
+		case gpm.PlanSkip:
+			line += fmt.Sprintf(" (exists as %s)", f.MediaKey)
+		case gpm.PlanFiltered, gpm.PlanError, gpm.PlanUnknown:
+			line += ": " + f.Reason
+		}
+		for _, album := range f.Albums {
+			line += fmt.Sprintf(" -> album %q", album)
+		}
+		fmt.Fprintln(w, line)
+	}
+	for _, a := range plan.Albums {
+		fmt.Fprintf(w, "album    %q (%d items)\n", a.Name, a.Items)
+	}
+
+	s := plan.Summary
+	_, err := fmt.Fprintf(w, "would upload %d (%s), skip %d, filter %d, errors %d, unchecked %d, create %d albums\n",
+		s.Upload, formatBytes(s.UploadBytes), s.Skip, s.Filtered, s.Errors, s.Unknown, len(plan.Albums))
+	return err
+}
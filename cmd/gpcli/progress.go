@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gpm "github.com/viperadnan-git/go-gpm"
+	"golang.org/x/term"
+)
+
+const (
+	progressRedrawInterval = 200 * time.Millisecond
+	progressRateSmoothing  = 0.2 // Weight of the newest sample in the throughput average
+)
+
+// fileProgress is a file currently being hashed or uploaded
+type fileProgress struct {
+	path    string
+	status  gpm.UploadStatus
+	done    int64
+	total   int64
+	started time.Time
+}
+
+// progressView renders a live status block at the bottom of a terminal: one line per
+// active file plus a summary with throughput and ETA. Log lines written through it
+// are printed above the block.
+type progressView struct {
+	mu    sync.Mutex
+	out   *os.File
+	lines int // Height of the block currently on screen
+
+	active   map[string]*fileProgress // Files being worked on, keyed by path
+	sizes    map[string]int64         // File sizes seen while hashing
+	inflight map[string]int64         // Bytes sent of files being uploaded
+
+	totalFiles, discovered, uploaded, skipped, failed int
+	concurrency, maxConcurrency                       int   // Upload threads allowed now and at the start
+	toSend, completedBytes                            int64 // Bytes that need uploading, and of finished files
+	transferred                                       int64 // Monotonic byte counter for throughput
+	lastTransferred                                   int64
+	lastSample                                        time.Time
+	rate                                              float64 // Smoothed bytes per second
+	control                                           *gpm.UploadControl
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// stdoutIsTerminal reports whether the live progress view can be used
+func stdoutIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// newProgressView starts redrawing the view until Close is called
+func newProgressView(out *os.File) *progressView {
+	v := &progressView{
+		out:        out,
+		active:     make(map[string]*fileProgress),
+		sizes:      make(map[string]int64),
+		inflight:   make(map[string]int64),
+		lastSample: time.Now(),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go v.loop()
+	return v
+}
+
+func (v *progressView) loop() {
+	defer close(v.done)
+	ticker := time.NewTicker(progressRedrawInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.stop:
+			return
+		case now := <-ticker.C:
+			v.mu.Lock()
+			v.sample(now)
+			v.redraw()
+			v.mu.Unlock()
+		}
+	}
+}
+
+// Close stops redrawing and removes the block from the screen
+func (v *progressView) Close() {
+	close(v.stop)
+	<-v.done
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clear()
+}
+
+// Write prints p above the status block, so the view can be used as log output
+func (v *progressView) Write(p []byte) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clear()
+	n, err := v.out.Write(p)
+	v.redraw()
+	return n, err
+}
+
+// Update applies an upload event to the view
+func (v *progressView) Update(event gpm.UploadEvent) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if event.Concurrency > 0 {
+		v.concurrency = event.Concurrency
+		v.maxConcurrency = max(v.maxConcurrency, event.Concurrency)
+	}
+	if event.Total > 0 {
+		v.totalFiles += event.Total
+		v.discovered = 0
+	} else if event.Discovered > 0 {
+		v.discovered = event.Discovered
+	}
+	if event.Path == "" {
+		return
+	}
+
+	switch event.Status {
+	case gpm.StatusHashing:
+		if !event.Progress {
+			v.sizes[event.Path] = event.BytesTotal
+			v.toSend += event.BytesTotal
+		}
+		v.setActive(event)
+	case gpm.StatusChecking:
+		delete(v.active, event.Path)
+	case gpm.StatusUploading:
+		if event.Progress {
+			v.transferred += max(0, event.BytesDone-v.inflight[event.Path])
+		}
+		v.inflight[event.Path] = event.BytesDone
+		v.setActive(event)
+	case gpm.StatusFinalizing, gpm.StatusVerifying, gpm.StatusRetrying:
+		v.setActive(event)
+	case gpm.StatusCompleted:
+		v.uploaded++
+		v.completedBytes += v.sizes[event.Path] + v.sizes[event.LiveVideo]
+		v.finish(event.Path, event.LiveVideo)
+	case gpm.StatusSkipped:
+		v.skipped++
+		v.toSend -= v.sizes[event.Path] + v.sizes[event.LiveVideo]
+		v.finish(event.Path, event.LiveVideo)
+	case gpm.StatusFailed:
+		v.failed++
+		v.toSend -= v.sizes[event.Path] + v.sizes[event.LiveVideo]
+		v.finish(event.Path, event.LiveVideo)
+	}
+}
+
+func (v *progressView) setActive(event gpm.UploadEvent) {
+	f, ok := v.active[event.Path]
+	if !ok || f.status != event.Status {
+		f = &fileProgress{path: event.Path, status: event.Status, started: time.Now()}
+		v.active[event.Path] = f
+	}
+	f.done = event.BytesDone
+	if event.BytesTotal > 0 {
+		f.total = event.BytesTotal
+	}
+}
+
+// finish drops the rows of the files an event finished, a Live Photo has two
+func (v *progressView) finish(paths ...string) {
+	for _, path := range paths {
+		delete(v.active, path)
+		delete(v.inflight, path)
+		delete(v.sizes, path)
+	}
+}
+
+// sample updates the smoothed throughput
+func (v *progressView) sample(now time.Time) {
+	elapsed := now.Sub(v.lastSample).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	current := float64(v.transferred-v.lastTransferred) / elapsed
+	v.rate = progressRateSmoothing*current + (1-progressRateSmoothing)*v.rate
+	v.lastTransferred, v.lastSample = v.transferred, now
+}
+
+// clear erases the status block, leaving the cursor where it started
+func (v *progressView) clear() {
+	if v.lines == 0 {
+		return
+	}
+	fmt.Fprintf(v.out, "\x1b[%dA\r\x1b[J", v.lines)
+	v.lines = 0
+}
+
+func (v *progressView) redraw() {
+	v.clear()
+	width := 80
+	if w, _, err := term.GetSize(int(v.out.Fd())); err == nil && w > 0 {
+		width = w
+	}
+
+	files := make([]*fileProgress, 0, len(v.active))
+	for _, f := range v.active {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].started.Before(files[j].started) })
+
+	lines := []string{v.summary()}
+	for _, f := range files {
+		lines = append(lines, fileLine(f))
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(truncate(line, width-1))
+		b.WriteString("\n")
+	}
+	v.out.WriteString(b.String())
+	v.lines = len(lines)
+}
+
+func (v *progressView) summary() string {
+	finished := v.uploaded + v.skipped + v.failed
+	total := fmt.Sprint(v.totalFiles)
+	if v.discovered > 0 {
+		total = fmt.Sprintf("%d+", v.totalFiles+v.discovered)
+	}
+	s := fmt.Sprintf("[%d/%s] uploaded %d, skipped %d, failed %d", finished, total, v.uploaded, v.skipped, v.failed)
+
+	var sent int64
+	for _, n := range v.inflight {
+		sent += n
+	}
+	sent += v.completedBytes
+	if v.toSend > 0 {
+		s += fmt.Sprintf(" | %s/%s", formatBytes(sent), formatBytes(v.toSend))
+	}
+	if v.control.Paused() {
+		s += " | paused"
+	}
+	if v.concurrency < v.maxConcurrency {
+		s += fmt.Sprintf(" | throttled to %d/%d threads", v.concurrency, v.maxConcurrency)
+	}
+	if v.rate >= 1 {
+		s += fmt.Sprintf(" | %s/s", formatBytes(int64(v.rate)))
+		if remaining := v.toSend - sent; remaining > 0 {
+			eta := time.Duration(float64(remaining)/v.rate) * time.Second
+			s += fmt.Sprintf(" | ETA %s", eta.Round(time.Second))
+		}
+	}
+	return s
+}
+
+func fileLine(f *fileProgress) string {
+	line := fmt.Sprintf("  %-10s %s", f.status, filepath.Base(f.path))
+	if f.total > 0 && f.done > 0 {
+		line += fmt.Sprintf("  %3d%% %s/%s", f.done*100/f.total, formatBytes(f.done), formatBytes(f.total))
+	} else if f.total > 0 {
+		line += "  " + formatBytes(f.total)
+	}
+	return line
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. "1.5 GiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// truncate shortens s to at most width runes
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width <= 0 || len(r) <= width {
+		return s
+	}
+	return string(r[:width])
+}
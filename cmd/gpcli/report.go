@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	gpm "github.com/viperadnan-git/go-gpm"
+)
+
+// uploadReport logs the events of an upload as they arrive and keeps the counts and
+// lists the summary needs
+type uploadReport struct {
+	threads int                         // Upload threads, for the scan log line
+	added   func(path, mediaKey string) // Called for each file in the library afterwards, may be nil
+
+	totalFiles, discovered                    int
+	uploaded, existing, failed, removed, kept int
+	concurrency                               int
+	mediaKeys                                 []string // Uploaded and skipped items
+	failures                                  []failedUpload
+	albums                                    map[string]*gpm.AlbumGroup // Albums from event metadata
+	albumOrder                                []string                   // Album names in first-seen order
+	keyPaths                                  map[string]string          // Path of each media key, for items left out of an album
+}
+
+// follow processes events until the channel is closed, showing live progress on a
+// terminal unless showProgress is off and plain logs otherwise
+func (r *uploadReport) follow(events <-chan gpm.UploadEvent, control *gpm.UploadControl, showProgress bool) {
+	var view *progressView
+	if showProgress && logFormat == "human" && currentLogLevel <= slog.LevelInfo && stdoutIsTerminal() {
+		view = newProgressView(os.Stdout)
+		view.control = control
+		setLogOutput(view)
+		defer func() {
+			view.Close()
+			setLogOutput(os.Stdout)
+		}()
+	}
+
+	for event := range events {
+		if view != nil {
+			view.Update(event)
+		}
+		if !event.Progress {
+			r.handle(event)
+		}
+	}
+}
+
+// counter shows the files done so far; files found by a walk that is still running
+// are counted as "n+" until its total arrives
+func (r *uploadReport) counter() string {
+	done := r.uploaded + r.existing + r.failed
+	if r.discovered > 0 {
+		return fmt.Sprintf("[%d/%d+]", done, r.totalFiles+r.discovered)
+	}
+	return fmt.Sprintf("[%d/%d]", done, r.totalFiles)
+}
+
+func (r *uploadReport) handle(event gpm.UploadEvent) {
+	if event.Concurrency > 0 {
+		if r.concurrency > 0 && event.Concurrency < r.concurrency {
+			logger.Warn("server is throttling, reducing upload threads", "threads", event.Concurrency)
+		} else if r.concurrency > 0 {
+			logger.Debug("increasing upload threads", "threads", event.Concurrency)
+		}
+		r.concurrency = event.Concurrency
+	}
+	if group := event.Duplicates; group != nil {
+		logger.Info("duplicate files", "files", len(group.Paths), "mediaKey", group.MediaKey, "paths", group.Paths)
+	}
+	if event.Total > 0 {
+		r.totalFiles += event.Total
+		r.discovered = 0
+		logger.Info("scan complete", "files", event.Total, "threads", r.threads)
+	} else if event.Discovered > 0 {
+		r.discovered = event.Discovered
+	}
+
+	switch event.Status {
+	case gpm.StatusHashing, gpm.StatusUploading, gpm.StatusVerifying:
+		logger.Debug(string(event.Status), "file", event.Path, "type", event.MediaType)
+	case gpm.StatusDeleted:
+		r.removed++
+		logger.Debug("deleted from host", "file", event.Path)
+	case gpm.StatusMoved:
+		r.removed++
+		logger.Debug("moved", "file", event.Path, "to", event.MovedTo)
+	case gpm.StatusKept:
+		r.kept++
+		logger.Warn("kept on host", "file", event.Path, "error", event.Error)
+	case gpm.StatusCompleted:
+		r.uploaded++
+		logger.Info(r.counter()+" uploaded", append([]any{"mediaKey", event.MediaKey, "file", event.Path}, extraAttrs(event)...)...)
+		r.addMedia(event)
+	case gpm.StatusSkipped:
+		r.existing++
+		logger.Info(r.counter()+" skipped", append([]any{"mediaKey", event.MediaKey, "file", event.Path, "exists", true}, extraAttrs(event)...)...)
+		r.addMedia(event)
+	case gpm.StatusRetrying:
+		logger.Warn("retrying", "file", event.Path, "attempt", event.Attempt, "error", event.Error)
+	case gpm.StatusFailed:
+		r.failed++
+		logger.Error(r.counter()+" failed", "file", event.Path, "error", event.Error)
+		if event.Path != "" {
+			r.failures = append(r.failures, newFailedUpload(event.Path, event.Error))
+		}
+		// Listing both halves lets a replay pair them again
+		if event.LiveVideo != "" {
+			r.failures = append(r.failures, newFailedUpload(event.LiveVideo, event.Error))
+		}
+	}
+}
+
+// extraAttrs returns the log attributes of a Live Photo's video half and of the
+// file a duplicate matched, if any
+func extraAttrs(event gpm.UploadEvent) []any {
+	var attrs []any
+	if event.LiveVideo != "" {
+		attrs = append(attrs, "liveVideo", event.LiveVideo, "liveVideoKey", event.LiveVideoMediaKey)
+	}
+	if event.DuplicateOf != "" {
+		attrs = append(attrs, "duplicateOf", event.DuplicateOf)
+	}
+	return attrs
+}
+
+func (r *uploadReport) addMedia(event gpm.UploadEvent) {
+	if event.MediaKey == "" {
+		return
+	}
+	if r.keyPaths == nil {
+		r.keyPaths = make(map[string]string)
+	}
+	// A Live Photo's video goes wherever its still goes
+	items := [][2]string{{event.Path, event.MediaKey}}
+	if event.LiveVideoMediaKey != "" {
+		items = append(items, [2]string{event.LiveVideo, event.LiveVideoMediaKey})
+	}
+	for _, item := range items {
+		path, mediaKey := item[0], item[1]
+		r.mediaKeys = append(r.mediaKeys, mediaKey)
+		r.keyPaths[mediaKey] = path
+		for _, album := range event.Albums {
+			r.addToAlbum(album, mediaKey)
+		}
+		if r.added != nil {
+			r.added(path, mediaKey)
+		}
+	}
+}
+
+// addToAlbum queues mediaKey for the album called name
+func (r *uploadReport) addToAlbum(name, mediaKey string) {
+	if r.albums == nil {
+		r.albums = make(map[string]*gpm.AlbumGroup)
+	}
+	group, ok := r.albums[name]
+	if !ok {
+		group = &gpm.AlbumGroup{Name: name}
+		r.albums[name] = group
+		r.albumOrder = append(r.albumOrder, name)
+	}
+	group.MediaKeys = append(group.MediaKeys, mediaKey)
+}
+
+// albumGroups returns the albums collected from event metadata
+func (r *uploadReport) albumGroups() []gpm.AlbumGroup {
+	groups := make([]gpm.AlbumGroup, 0, len(r.albumOrder))
+	for _, name := range r.albumOrder {
+		groups = append(groups, *r.albums[name])
+	}
+	return groups
+}
+
+// createAlbums creates groups and logs each album that is ready. Items that can't
+// be added to a created album are warned about and recorded as failures, for
+// the failed files list; albums that can't be created are returned as an error
+// once the others are done. Either way the error tells the caller the albums are
+// incomplete.
+func (r *uploadReport) createAlbums(api *gpm.GooglePhotosAPI, groups []gpm.AlbumGroup) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	logger.Info("creating albums", "albums", len(groups))
+	var errs []error
+	missing := 0
+	for _, group := range groups {
+		albumKey, err := api.CreateAlbumWithMedia(group.Name, group.MediaKeys)
+		if albumKey == "" {
+			errs = append(errs, fmt.Errorf("album %s: %w", group.Name, err))
+			continue
+		}
+		added := len(group.MediaKeys)
+		var addErr *gpm.AlbumAddError
+		if errors.As(err, &addErr) {
+			logger.Warn("failed to add items to album", "album", group.Name, "items", len(addErr.MediaKeys), "error", addErr.Err)
+			for _, mediaKey := range addErr.MediaKeys {
+				r.failures = append(r.failures, newFailedUpload(r.keyPaths[mediaKey], addErr))
+			}
+			added -= len(addErr.MediaKeys)
+			missing += len(addErr.MediaKeys)
+		}
+		logger.Info("album ready", "album", group.Name, "items", added)
+	}
+	if missing > 0 {
+		errs = append(errs, fmt.Errorf("%d items are missing from their albums", missing))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to create albums: %w", err)
+	}
+	return nil
+}
+
+// summarize logs the totals and writes the failed files to failedFile, if set
+func (r *uploadReport) summarize(removing bool, failedFile string) {
+	logger.Info("upload complete", "uploaded", r.uploaded, "skipped", r.existing, "failed", r.failed)
+	if removing {
+		logger.Info("host cleanup", "removed", r.removed, "kept", r.kept)
+	}
+	if failedFile == "" {
+		return
+	}
+	if err := writeFailedUploads(failedFile, r.failures); err != nil {
+		logger.Error("failed to write failed files list", "error", err)
+	} else if len(r.failures) > 0 {
+		logger.Info("failed files written", "file", failedFile, "replay", "gpcli upload --from-file "+failedFile)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	gpm "github.com/viperadnan-git/go-gpm"
+)
+
+// handleUploadSignals drives ctl from signals until the returned function is called.
+// The first interrupt stops the upload once the files being sent have finished and
+// the second aborts them; the pause signals, where the platform has them, toggle a
+// pause.
+func handleUploadSignals(ctl *gpm.UploadControl) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, pauseSignals...)...)
+	done := make(chan struct{})
+
+	go func() {
+		interrupts := 0
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				switch {
+				case isPauseSignal(sig):
+					if ctl.Paused() {
+						ctl.Resume()
+						logger.Info("upload resumed")
+					} else {
+						ctl.Pause()
+						logger.Info("upload paused, press Ctrl+Z again to resume")
+					}
+				case isResumeSignal(sig):
+					if ctl.Paused() {
+						ctl.Resume()
+						logger.Info("upload resumed")
+					}
+				default:
+					interrupts++
+					if interrupts == 1 {
+						logger.Warn("stopping after files in progress, interrupt again to abort")
+						ctl.Stop(true)
+					} else {
+						logger.Warn("aborting upload")
+						ctl.Stop(false)
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// pauseSignals is empty where there is no job control
+var pauseSignals []os.Signal
+
+func isPauseSignal(os.Signal) bool {
+	return false
+}
+
+func isResumeSignal(os.Signal) bool {
+	return false
+}
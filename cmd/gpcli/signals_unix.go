@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignals are caught to pause and resume uploads instead of suspending the process
+var pauseSignals = []os.Signal{syscall.SIGTSTP, syscall.SIGCONT}
+
+func isPauseSignal(sig os.Signal) bool {
+	return sig == syscall.SIGTSTP
+}
+
+func isResumeSignal(sig os.Signal) bool {
+	return sig == syscall.SIGCONT
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	gpm "github.com/viperadnan-git/go-gpm"
+
+	"github.com/urfave/cli/v3"
+)
+
+func importTakeoutAction(ctx context.Context, cmd *cli.Command) error {
+	sources := cmd.Args().Slice()
+	if len(sources) == 0 {
+		return fmt.Errorf("give at least one Takeout directory or zip file")
+	}
+
+	if err := loadConfig(); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg := cfgManager.GetConfig()
+
+	threads := int(cmd.Int("threads"))
+	if threads == 0 {
+		threads = cfg.UploadThreads
+	}
+	quality := cmd.String("quality")
+	if quality == "" {
+		quality = cfg.Quality
+	}
+	if quality != "original" && quality != "storage-saver" {
+		return fmt.Errorf("invalid quality: %s (use 'original' or 'storage-saver')", quality)
+	}
+
+	// The zips of a multi-part export are scanned together, so sidecars and album
+	// metadata in one part still find their media in another. Their media are read
+	// straight from the archives, without extracting them.
+	var roots, zips []string
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			return fmt.Errorf("file or directory does not exist: %s", source)
+		}
+		if info.IsDir() {
+			roots = append(roots, source)
+		} else {
+			zips = append(zips, source)
+		}
+	}
+
+	// Pair media with sidecars
+	var items []gpm.TakeoutItem
+	for _, root := range roots {
+		found := gpm.ScanTakeout(root, func(path string, err error) {
+			logger.Warn("skipping unreadable path", "path", path, "error", err)
+		})
+		items = append(items, found...)
+	}
+	if len(zips) > 0 {
+		found, err := gpm.ScanTakeoutArchives(zips)
+		if err != nil {
+			return err
+		}
+		items = append(items, found...)
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no media found in the Takeout export")
+	}
+	byPath := make(map[string]gpm.TakeoutItem, len(items))
+	paths := make([]string, 0, len(items))
+	missing := 0
+	for _, item := range items {
+		byPath[item.Path] = item
+		paths = append(paths, item.Path)
+		if item.Metadata == nil {
+			missing++
+			logger.Debug("no sidecar", "file", item.Path)
+		}
+	}
+	logger.Info("takeout scanned", "files", len(items), "without sidecar", missing)
+
+	authData := getAuthData(cfg)
+	if authData == "" {
+		return fmt.Errorf("no authentication configured. Use 'gpcli auth add' to add credentials")
+	}
+	api, err := gpm.NewGooglePhotosAPI(gpm.ApiConfig{
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create API client: %w", err)
+	}
+
+	noAlbums := cmd.Bool("no-albums")
+	control := gpm.NewUploadControl()
+	stopSignals := handleUploadSignals(control)
+	defer stopSignals()
+
+	// Files without a sidecar fall back to their embedded date
+	opts := gpm.UploadOptions{
+		Workers:         threads,
+		ForceUpload:     cmd.Bool("force"),
+		Quality:         quality,
+		UseQuota:        cmd.Bool("use-quota") || cfg.UseQuota,
+		TimestampSource: gpm.TimestampAuto,
+		Retries:         int(cmd.Int("retries")),
+		RetryDelay:      cmd.Duration("retry-delay"),
+		Control:         control,
+		TempDir:         cmd.String("temp-dir"),
+		Metadata: func(path string) *gpm.FileMetadata {
+			item := byPath[path]
+			fm := &gpm.FileMetadata{}
+			if item.Metadata != nil {
+				fm.Timestamp = item.Metadata.TakenTime
+				fm.Caption = item.Metadata.Description
+				fm.Favourite = item.Metadata.Favorited
+				fm.Archive = item.Metadata.Archived
+			}
+			if item.Album != "" && !noAlbums {
+				fm.Albums = []string{item.Album}
+			}
+			return fm
+		},
+	}
+
+	report := &uploadReport{threads: threads}
+	report.follow(api.Upload(ctx, paths, opts), control, !cmd.Bool("no-progress"))
+	// Albums first, so items left out of one are in the failed files list
+	albumErr := report.createAlbums(api, report.albumGroups())
+	report.summarize(false, cmd.String("failed-file"))
+	return albumErr
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	gpm "github.com/viperadnan-git/go-gpm"
 
@@ -12,10 +13,60 @@ import (
 
 func uploadAction(ctx context.Context, cmd *cli.Command) error {
 	filePath := cmd.StringArg("filepath")
+	fromFile := cmd.String("from-file")
+	watch := cmd.Bool("watch")
 
-	// Validate that filepath exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file or directory does not exist: %s", filePath)
+	// "-" reads a single file from stdin, otherwise validate that filepath exists
+	fromStdin := filePath == "-"
+	stdinName := cmd.String("name")
+	var paths []string
+	if fromStdin {
+		if stdinName == "" {
+			return fmt.Errorf("--name is required when uploading from stdin")
+		}
+		if watch {
+			return fmt.Errorf("--watch cannot be used when uploading from stdin")
+		}
+		if fromFile != "" {
+			return fmt.Errorf("--from-file cannot be used when uploading from stdin")
+		}
+	} else {
+		if filePath != "" {
+			if _, err := os.Stat(filePath); os.IsNotExist(err) {
+				return fmt.Errorf("file or directory does not exist: %s", filePath)
+			}
+			paths = append(paths, filePath)
+		}
+		// Listed paths that no longer exist are reported as failed by the upload
+		if fromFile != "" {
+			if watch {
+				return fmt.Errorf("--watch cannot be used with --from-file")
+			}
+			listed, err := readUploadList(fromFile)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, listed...)
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("nothing to upload: give a file or directory, or --from-file")
+		}
+	}
+
+	dryRun := cmd.Bool("dry-run")
+	planFormat := cmd.String("plan-format")
+	if dryRun {
+		if fromStdin || watch {
+			return fmt.Errorf("--dry-run cannot be used with --watch or stdin")
+		}
+		if planFormat != "text" && planFormat != "json" {
+			return fmt.Errorf("invalid plan format: %s (use 'text' or 'json')", planFormat)
+		}
+		if planFormat == "json" {
+			// Keep stdout parseable
+			setLogOutput(os.Stderr)
+			defer setLogOutput(os.Stdout)
+		}
 	}
 
 	// Load config
@@ -36,20 +87,92 @@ func uploadAction(ctx context.Context, cmd *cli.Command) error {
 	if quality != "original" && quality != "storage-saver" {
 		return fmt.Errorf("invalid quality: %s (use 'original' or 'storage-saver')", quality)
 	}
+	timestamp := gpm.TimestampSource(cmd.String("timestamp"))
+	switch timestamp {
+	case gpm.TimestampMtime, gpm.TimestampExif, gpm.TimestampAuto:
+	default:
+		return fmt.Errorf("invalid timestamp source: %s (use 'mtime', 'exif' or 'auto')", timestamp)
+	}
+	if _, err := gpm.ParseCaptionTemplate(cmd.String("caption")); err != nil {
+		return err
+	}
+	xmp, err := xmpMapping(cmd)
+	if err != nil {
+		return err
+	}
+	livePhotos, err := livePhotoOptions(cmd)
+	if err != nil {
+		return err
+	}
 	albumName := cmd.String("album")
 
+	// Removing originals is only done after the library copy is verified
+	deleteFromHost, moveTo := cmd.Bool("delete"), cmd.String("move-to")
+	if moveTo != "" {
+		if deleteFromHost {
+			return fmt.Errorf("--delete and --move-to cannot be used together")
+		}
+		for _, path := range paths {
+			if isWithin(moveTo, path) {
+				return fmt.Errorf("--move-to must be outside of %s", path)
+			}
+		}
+	}
+	removing := deleteFromHost || moveTo != ""
+	if cmd.Bool("verify-download") {
+		if !removing {
+			return fmt.Errorf("--verify-download requires --delete or --move-to")
+		}
+		if quality != "original" {
+			return fmt.Errorf("--verify-download only works with original quality uploads")
+		}
+	}
+
+	// Group uploads into one album per source folder
+	var albums *gpm.AlbumMapper
+	if cmd.Bool("album-per-folder") {
+		if albumName != "" {
+			return fmt.Errorf("--album and --album-per-folder cannot be used together")
+		}
+		if fromStdin {
+			return fmt.Errorf("--album-per-folder cannot be used when uploading from stdin")
+		}
+		mapper, err := gpm.NewAlbumMapper(cmd.String("album-template"), paths)
+		if err != nil {
+			return err
+		}
+		albums = mapper
+	}
+
 	// Build upload options from CLI flags
 	uploadOpts := gpm.UploadOptions{
-		Workers:         threads,
-		Recursive:       cmd.Bool("recursive"),
-		ForceUpload:     cmd.Bool("force"),
-		DeleteFromHost:  cmd.Bool("delete"),
-		DisableFilter:   cmd.Bool("disable-filter"),
-		Caption:         cmd.String("caption"),
-		ShouldFavourite: cmd.Bool("favourite"),
-		ShouldArchive:   cmd.Bool("archive"),
-		Quality:         quality,
-		UseQuota:        cmd.Bool("use-quota") || cfg.UseQuota,
+		Workers:          threads,
+		HashWorkers:      int(cmd.Int("hash-threads")),
+		CheckWorkers:     int(cmd.Int("check-threads")),
+		QueueSize:        int(cmd.Int("queue-size")),
+		SerialDiskReads:  cmd.Bool("hdd"),
+		Recursive:        cmd.Bool("recursive"),
+		ForceUpload:      cmd.Bool("force"),
+		DeleteFromHost:   deleteFromHost,
+		MoveTo:           moveTo,
+		VerifyDownload:   cmd.Bool("verify-download"),
+		DisableFilter:    cmd.Bool("disable-filter"),
+		FollowSymlinks:   cmd.Bool("follow-symlinks"),
+		Archives:         cmd.Bool("archives"),
+		TempDir:          cmd.String("temp-dir"),
+		Include:          cmd.StringSlice("include"),
+		Exclude:          cmd.StringSlice("exclude"),
+		Caption:          cmd.String("caption"),
+		ShouldFavourite:  cmd.Bool("favourite"),
+		ShouldArchive:    cmd.Bool("archive"),
+		Quality:          quality,
+		UseQuota:         cmd.Bool("use-quota") || cfg.UseQuota,
+		TimestampSource:  timestamp,
+		Retries:          int(cmd.Int("retries")),
+		RetryDelay:       cmd.Duration("retry-delay"),
+		XMP:              xmp,
+		LivePhotos:       livePhotos,
+		ReportDuplicates: cmd.Bool("report-duplicates"),
 	}
 
 	// Resolve auth data
@@ -60,77 +183,113 @@ func uploadAction(ctx context.Context, cmd *cli.Command) error {
 
 	// Build API config
 	apiCfg := gpm.ApiConfig{
-		AuthData: authData,
-		Proxy:    cfg.Proxy,
+		AuthData:       authData,
+		Proxy:          cfg.Proxy,
+		CacheDir:       getCacheDir(cfg),
+		BandwidthLimit: getBandwidthLimit(cfg),
 	}
 
 	// Log start
-	logger.Info("scanning files", "path", filePath)
+	if len(paths) == 1 {
+		logger.Info("scanning files", "path", paths[0])
+	} else {
+		logger.Info("scanning files", "paths", len(paths))
+	}
 
 	api, err := gpm.NewGooglePhotosAPI(apiCfg)
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
 	}
 
-	// Track results
-	var totalFiles, uploaded, existing, failed int
-	var successfulMediaKeys []string
-
-	// Process upload events
-	for event := range api.Upload(ctx, []string{filePath}, uploadOpts) {
-		if event.Total > 0 {
-			totalFiles = event.Total
-			logger.Info("starting upload", "files", totalFiles, "threads", threads)
+	if dryRun {
+		var albumFor func(string) string
+		if albums != nil {
+			albumFor = albums.AlbumName
+		} else if albumName != "" {
+			albumFor = func(string) string { return albumName }
 		}
-
-		switch event.Status {
-		case gpm.StatusHashing, gpm.StatusUploading:
-			logger.Debug(string(event.Status), "file", event.Path)
-		case gpm.StatusCompleted:
-			uploaded++
-			progress := fmt.Sprintf("[%d/%d]", uploaded+existing+failed, totalFiles)
-			logger.Info(progress+" uploaded", "mediaKey", event.MediaKey, "file", event.Path)
-			if event.MediaKey != "" {
-				successfulMediaKeys = append(successfulMediaKeys, event.MediaKey)
-			}
-		case gpm.StatusSkipped:
-			existing++
-			progress := fmt.Sprintf("[%d/%d]", uploaded+existing+failed, totalFiles)
-			logger.Info(progress+" skipped", "mediaKey", event.MediaKey, "file", event.Path, "exists", true)
-			if event.MediaKey != "" {
-				successfulMediaKeys = append(successfulMediaKeys, event.MediaKey)
-			}
-		case gpm.StatusFailed:
-			failed++
-			progress := fmt.Sprintf("[%d/%d]", uploaded+existing+failed, totalFiles)
-			logger.Error(progress+" failed", "file", event.Path, "error", event.Error)
+		plan, err := api.PlanUpload(ctx, paths, uploadOpts, albumFor)
+		if err != nil {
+			return fmt.Errorf("failed to plan upload: %w", err)
 		}
+		return printPlan(os.Stdout, plan, planFormat)
 	}
 
-	// Print summary
-	logger.Info("upload complete", "uploaded", uploaded, "skipped", existing, "failed", failed)
+	// Interrupts stop cleanly so the summary, failed files and albums still happen
+	control := gpm.NewUploadControl()
+	uploadOpts.Control = control
+	stopSignals := handleUploadSignals(control)
+	defer stopSignals()
 
-	// Handle album creation if album name was specified
-	if albumName != "" && len(successfulMediaKeys) > 0 {
-		logger.Info("adding to album", "album", albumName)
+	var events <-chan gpm.UploadEvent
+	if fromStdin {
+		events = api.UploadReader(ctx, os.Stdin, stdinName, -1, time.Time{}, uploadOpts)
+	} else if watch {
+		events = api.Watch(ctx, paths, uploadOpts)
+	} else {
+		events = api.Upload(ctx, paths, uploadOpts)
+	}
 
-		const batchSize = 500
-		firstBatchEnd := min(batchSize, len(successfulMediaKeys))
+	// Process upload events (watch mode emits one batch after another)
+	report := &uploadReport{threads: threads}
+	if albums != nil {
+		report.added = albums.Add
+	}
+	report.follow(events, control, !cmd.Bool("no-progress"))
 
-		albumMediaKey, err := api.CreateAlbum(albumName, successfulMediaKeys[:firstBatchEnd])
-		if err != nil {
-			return fmt.Errorf("failed to create album: %w", err)
-		}
+	// The album named by --album or the albums per folder, then the ones from XMP
+	// rules. Albums come before the summary so items left out of one are in the
+	// failed files list.
+	var groups []gpm.AlbumGroup
+	if albumName != "" && len(report.mediaKeys) > 0 {
+		groups = append(groups, gpm.AlbumGroup{Name: albumName, MediaKeys: report.mediaKeys})
+	}
+	if albums != nil {
+		groups = append(groups, albums.Groups()...)
+	}
+	albumErr := report.createAlbums(api, append(groups, report.albumGroups()...))
+	report.summarize(removing, cmd.String("failed-file"))
+	return albumErr
+}
 
-		for i := batchSize; i < len(successfulMediaKeys); i += batchSize {
-			end := min(i+batchSize, len(successfulMediaKeys))
-			if err = api.AddMediaToAlbum(albumMediaKey, successfulMediaKeys[i:end]); err != nil {
-				logger.Warn("failed to add batch to album", "error", err)
-			}
+// xmpMapping builds the XMP mapping from the --xmp-* flags, nil if none is set
+func xmpMapping(cmd *cli.Command) (*gpm.XMPMapping, error) {
+	mapping := &gpm.XMPMapping{
+		Caption:         cmd.Bool("xmp-caption"),
+		FavouriteRating: int(cmd.Int("xmp-favourite-rating")),
+	}
+	if mapping.FavouriteRating < 0 || mapping.FavouriteRating > 5 {
+		return nil, fmt.Errorf("invalid --xmp-favourite-rating: %d (use 1 to 5)", mapping.FavouriteRating)
+	}
+	for _, s := range cmd.StringSlice("xmp-album") {
+		rule, err := gpm.ParseXMPAlbumRule(s)
+		if err != nil {
+			return nil, err
 		}
-
-		logger.Info("album ready", "album", albumName, "items", len(successfulMediaKeys))
+		mapping.Albums = append(mapping.Albums, rule)
+	}
+	if !mapping.Caption && mapping.FavouriteRating == 0 && len(mapping.Albums) == 0 {
+		return nil, nil
 	}
+	return mapping, nil
+}
 
-	return nil
+// livePhotoOptions builds the Live Photo options from the --live-* flags, nil if none is set
+func livePhotoOptions(cmd *cli.Command) (*gpm.LivePhotoOptions, error) {
+	opts := &gpm.LivePhotoOptions{
+		Video:        gpm.LivePhotoVideo(cmd.String("live-video")),
+		VideoCaption: cmd.String("live-video-caption"),
+	}
+	switch opts.Video {
+	case "", gpm.LivePhotoVideoUpload, gpm.LivePhotoVideoArchive, gpm.LivePhotoVideoSkip:
+	default:
+		return nil, fmt.Errorf("invalid --live-video: %s (use 'upload', 'archive' or 'skip')", opts.Video)
+	}
+	if _, err := gpm.ParseCaptionTemplate(opts.VideoCaption); err != nil {
+		return nil, err
+	}
+	if !cmd.Bool("live-photos") && opts.Video == "" && opts.VideoCaption == "" {
+		return nil, nil
+	}
+	return opts, nil
 }
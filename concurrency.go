@@ -0,0 +1,258 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleCooldown is how long after cutting the limit further throttling is put
+// down to the same overload instead of cutting again
+const throttleCooldown = 2 * time.Second
+
+// concurrencyLimiter adapts the number of transfers running at once to server
+// back-pressure, AIMD style: a 429 or 503 halves the limit and holds new transfers
+// back for the Retry-After delay, and every successful transfer grows the limit by
+// 1/limit, so about one slot per round of successes, up to max. Only the run's own
+// transfers are observed, other requests on the client don't move its limit.
+type concurrencyLimiter struct {
+	max int
+
+	mu           sync.Mutex
+	limit        float64
+	active       int
+	pausedUntil  time.Time
+	lastDecrease time.Time
+	changed      chan struct{} // Closed and replaced whenever a slot may have opened up
+	updates      chan int      // Latest whole limit after it changes, for reporting
+}
+
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		max:     max,
+		limit:   float64(max),
+		changed: make(chan struct{}),
+		updates: make(chan int, 1),
+	}
+}
+
+// current returns the whole number of transfers allowed, at least 1
+func (l *concurrencyLimiter) current() int {
+	return max(1, int(l.limit))
+}
+
+// acquire waits for a free slot, returning false if ctx is cancelled first
+func (l *concurrencyLimiter) acquire(ctx context.Context) bool {
+	for {
+		l.mu.Lock()
+		wait := time.Until(l.pausedUntil)
+		if wait <= 0 && l.active < l.current() {
+			l.active++
+			l.mu.Unlock()
+			return true
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		var timer *time.Timer
+		var resume <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			resume = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-resume:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+	}
+}
+
+// release frees a slot taken by acquire
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.broadcast()
+}
+
+// observe feeds the controller the status of a transfer and the Retry-After delay asked for
+func (l *concurrencyLimiter) observe(statusCode int, retryAfter time.Duration) {
+	switch {
+	case statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable:
+		l.throttled(retryAfter)
+	case statusCode >= 200 && statusCode < 300:
+		l.succeeded()
+	}
+}
+
+func (l *concurrencyLimiter) throttled(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	if now.Sub(l.lastDecrease) < throttleCooldown {
+		return
+	}
+	l.lastDecrease = now
+	before := l.current()
+	l.limit = max(1, l.limit/2)
+	l.report(before)
+}
+
+func (l *concurrencyLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit >= float64(l.max) {
+		return
+	}
+	before := l.current()
+	l.limit = min(float64(l.max), l.limit+1/l.limit)
+	l.report(before)
+	l.broadcast()
+}
+
+// report queues the limit for reporting if its whole value changed from before
+func (l *concurrencyLimiter) report(before int) {
+	n := l.current()
+	if n == before {
+		return
+	}
+	select {
+	case <-l.updates:
+	default:
+	}
+	l.updates <- n
+}
+
+func (l *concurrencyLimiter) broadcast() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// uploadRun holds what the workers of one Upload call share
+// A nil run, as used for single uploads, applies no limits.
+type uploadRun struct {
+	gate    *diskGate // nil unless SerialDiskReads
+	limiter *concurrencyLimiter
+	batch   *uploadBatch     // Share of the client's transfer budget
+	control *UploadControl   // nil unless UploadOptions.Control is set
+	caption *CaptionTemplate // nil unless UploadOptions.Caption is set
+
+	videoCaption *CaptionTemplate  // Caption of Live Photo video halves, nil captions them like any file
+	liveVideo    LivePhotoVideo    // What happens to Live Photo video halves
+	spoolDir     string            // Temp directory for archive members, empty for the system one
+	duplicates   *duplicateTracker // nil doesn't look for identical files
+	dryRun       bool              // Hashes are looked up in the hash cache but not stored
+}
+
+// readerAt wraps r so its reads go through the disk gate and wait while paused
+func (r *uploadRun) readerAt(ctx context.Context, ra io.ReaderAt) io.ReaderAt {
+	if r == nil {
+		return ra
+	}
+	return r.control.readerAt(ctx, r.gate.readerAt(ra))
+}
+
+// acquire waits for a transfer slot, first in this upload and then in the client's budget
+func (r *uploadRun) acquire(ctx context.Context) bool {
+	if r == nil {
+		return ctx.Err() == nil
+	}
+	if r.limiter != nil && !r.limiter.acquire(ctx) {
+		return false
+	}
+	if r.batch != nil && !r.batch.acquire(ctx) {
+		if r.limiter != nil {
+			r.limiter.release()
+		}
+		return false
+	}
+	return true
+}
+
+// wait blocks while the upload is paused
+func (r *uploadRun) wait(ctx context.Context) bool {
+	if r == nil {
+		return ctx.Err() == nil
+	}
+	return r.control.wait(ctx)
+}
+
+// begin waits out a pause and takes a transfer slot for a file. It returns false,
+// holding no slot, if ctx ends or if the upload is stopping and the file hadn't
+// started before: a file stopped while queued for a slot is never started.
+func (r *uploadRun) begin(ctx context.Context, started bool) bool {
+	if !r.wait(ctx) || !r.acquire(ctx) {
+		return false
+	}
+	if !started && r.stopping() {
+		r.release()
+		return false
+	}
+	return true
+}
+
+// stopping reports whether the upload has been told to stop
+func (r *uploadRun) stopping() bool {
+	if r == nil || r.control == nil {
+		return false
+	}
+	return isClosed(r.control.stopping)
+}
+
+// captionFor evaluates the caption template for item, empty if there is none
+func (r *uploadRun) captionFor(item uploadItem) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	caption := r.caption
+	if item.liveStill && r.videoCaption != nil {
+		caption = r.videoCaption
+	}
+	if caption == nil {
+		return "", nil
+	}
+	// Fields like {date} read the file's metadata
+	var text string
+	var err error
+	r.gate.do(func() { text, err = caption.Caption(captionData(item)) })
+	return text, err
+}
+
+// observe feeds the outcome of one of the run's transfer attempts to its limiter
+func (r *uploadRun) observe(err error) {
+	if r == nil || r.limiter == nil {
+		return
+	}
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		r.limiter.observe(http.StatusOK, 0)
+	case errors.As(err, &statusErr):
+		r.limiter.observe(statusErr.StatusCode, statusErr.RetryAfter)
+	}
+}
+
+func (r *uploadRun) release() {
+	if r == nil {
+		return
+	}
+	if r.batch != nil {
+		r.batch.release()
+	}
+	if r.limiter != nil {
+		r.limiter.release()
+	}
+}
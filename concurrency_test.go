@@ -0,0 +1,156 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	type step struct {
+		status int
+		times  int
+		later  bool // The cooldown since the last cut has passed
+	}
+	ok := func(n int) step { return step{status: http.StatusOK, times: n} }
+	throttle := func(later bool) step { return step{status: http.StatusTooManyRequests, times: 1, later: later} }
+
+	tests := []struct {
+		name  string
+		max   int
+		steps []step
+		want  int
+	}{
+		{"starts at max", 8, nil, 8},
+		{"successes don't exceed max", 8, []step{ok(100)}, 8},
+		{"throttling halves", 8, []step{throttle(true)}, 4},
+		{"503 halves too", 8, []step{{status: http.StatusServiceUnavailable, times: 1, later: true}}, 4},
+		{"other errors are ignored", 8, []step{{status: http.StatusInternalServerError, times: 5, later: true}, {status: http.StatusBadRequest, times: 5}}, 8},
+		{"repeat throttling within the cooldown counts once", 8, []step{throttle(true), throttle(false), throttle(false)}, 4},
+		{"throttling after the cooldown halves again", 8, []step{throttle(true), throttle(true)}, 2},
+		{"never below one", 2, []step{throttle(true), throttle(true), throttle(true)}, 1},
+		{"a round of successes adds about one", 8, []step{throttle(true), ok(5)}, 5},
+		{"rounds grow with the limit", 8, []step{throttle(true), ok(5), ok(6)}, 6},
+		{"recovers to max", 8, []step{throttle(true), throttle(true), ok(1000)}, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newConcurrencyLimiter(tt.max)
+			for _, s := range tt.steps {
+				for range s.times {
+					if s.later {
+						l.lastDecrease = l.lastDecrease.Add(-throttleCooldown)
+					}
+					l.observe(s.status, 0)
+				}
+			}
+			if got := l.current(); got != tt.want {
+				t.Errorf("current() = %d (limit %.2f), want %d", got, l.limit, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadRunObserve(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success grows", nil, 5},
+		{"throttled transfer halves", fmt.Errorf("upload failed: %w", &StatusError{StatusCode: http.StatusTooManyRequests}), 2},
+		{"server error is ignored", &StatusError{StatusCode: http.StatusInternalServerError}, 4},
+		{"network error is ignored", errors.New("connection reset by peer"), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newConcurrencyLimiter(8)
+			l.limit = 4
+			run := &uploadRun{limiter: l}
+			for range 5 { // About a round at a limit of 4
+				run.observe(tt.err)
+			}
+			if got := l.current(); got != tt.want {
+				t.Errorf("current() = %d (limit %.2f), want %d", got, l.limit, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterReportsChanges(t *testing.T) {
+	l := newConcurrencyLimiter(8)
+	l.observe(http.StatusTooManyRequests, 0)
+	l.lastDecrease = l.lastDecrease.Add(-throttleCooldown)
+	l.observe(http.StatusTooManyRequests, 0)
+
+	// Only the latest limit is kept for the reader
+	select {
+	case n := <-l.updates:
+		if n != 2 {
+			t.Errorf("update = %d, want 2", n)
+		}
+	default:
+		t.Fatal("no update after the limit changed")
+	}
+	l.observe(http.StatusOK, 0) // 2 to 2.5, no whole change
+	select {
+	case n := <-l.updates:
+		t.Errorf("unexpected update %d", n)
+	default:
+	}
+}
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	l := newConcurrencyLimiter(2)
+	ctx := context.Background()
+	if !l.acquire(ctx) || !l.acquire(ctx) {
+		t.Fatal("acquire failed below the limit")
+	}
+
+	// A third transfer waits for a slot
+	acquired := make(chan bool, 1)
+	go func() { acquired <- l.acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire succeeded above the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.release()
+	select {
+	case ok := <-acquired:
+		if !ok {
+			t.Fatal("acquire failed after a release")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire still waiting after a release")
+	}
+
+	// Cancelling gives up the wait
+	cancelled, cancel := context.WithCancel(ctx)
+	go func() { acquired <- l.acquire(cancelled) }()
+	cancel()
+	select {
+	case ok := <-acquired:
+		if ok {
+			t.Fatal("acquire succeeded after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire still waiting after cancel")
+	}
+}
+
+func TestConcurrencyLimiterRetryAfter(t *testing.T) {
+	l := newConcurrencyLimiter(4)
+	l.observe(http.StatusTooManyRequests, 100*time.Millisecond)
+
+	start := time.Now()
+	if !l.acquire(context.Background()) {
+		t.Fatal("acquire failed")
+	}
+	if waited := time.Since(start); waited < 80*time.Millisecond {
+		t.Errorf("acquire returned after %v, want it held back for Retry-After", waited)
+	}
+}
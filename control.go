@@ -0,0 +1,158 @@
+package gpm
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"sync"
+)
+
+// UploadControl pauses, resumes and stops running uploads. Pass it in
+// UploadOptions.Control; its methods may be called from any goroutine, and one
+// control can drive several Upload calls, such as the batches of Watch.
+// A nil *UploadControl is valid and never pauses or stops.
+type UploadControl struct {
+	mu       sync.Mutex
+	resumed  chan struct{} // Closed by Resume, nil while running
+	stopping chan struct{} // Closed by Stop
+	aborting chan struct{} // Closed by Stop(false)
+}
+
+// NewUploadControl returns a control for an upload that hasn't been paused or stopped
+func NewUploadControl() *UploadControl {
+	return &UploadControl{stopping: make(chan struct{}), aborting: make(chan struct{})}
+}
+
+// Pause holds back hashing and transfers until Resume. Files being read stop at the
+// next chunk; an upload paused for long enough may have to resume from the server's
+// offset once it continues.
+func (c *UploadControl) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed == nil && !isClosed(c.stopping) {
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues a paused upload
+func (c *UploadControl) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+	}
+}
+
+// Paused reports whether the upload is paused
+func (c *UploadControl) Paused() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed != nil
+}
+
+// Stop ends the upload. A graceful stop lets files that are already being
+// transferred finish and drops everything else; otherwise in-flight transfers are
+// aborted too, leaving their sessions to be resumed by a later upload. A graceful
+// stop can be turned into an abort by calling Stop(false) afterwards. Stopping
+// also resumes a paused upload.
+func (c *UploadControl) Stop(graceful bool) {
+	c.mu.Lock()
+	if !isClosed(c.stopping) {
+		close(c.stopping)
+	}
+	if !graceful && !isClosed(c.aborting) {
+		close(c.aborting)
+	}
+	c.mu.Unlock()
+	c.Resume()
+}
+
+// stopped is closed once Stop has been called
+func (c *UploadControl) stopped() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	return c.stopping
+}
+
+// contexts derives the contexts for one Upload call: intake, for walking, hashing,
+// checking and starting transfers, ends on any Stop; transfer, for transfers
+// already running, only on Stop(false). cancel releases both.
+func (c *UploadControl) contexts(ctx context.Context) (intake, transfer context.Context, cancel func()) {
+	if c == nil {
+		return ctx, ctx, func() {}
+	}
+	transfer, cancelTransfer := context.WithCancel(ctx)
+	intake, cancelIntake := context.WithCancel(transfer)
+	go func() {
+		select {
+		case <-c.stopping:
+			cancelIntake()
+		case <-transfer.Done():
+			return
+		}
+		select {
+		case <-c.aborting:
+			cancelTransfer()
+		case <-transfer.Done():
+		}
+	}()
+	return intake, transfer, func() {
+		cancelIntake()
+		cancelTransfer()
+	}
+}
+
+// wait blocks while the upload is paused, returning false if ctx ends first or the
+// upload is aborted. An abort resumes waiters before their contexts are cancelled,
+// so it is checked here as well.
+func (c *UploadControl) wait(ctx context.Context) bool {
+	if c == nil {
+		return ctx.Err() == nil
+	}
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return ctx.Err() == nil && !isClosed(c.aborting)
+}
+
+// readerAt wraps r so reads block while the upload is paused
+func (c *UploadControl) readerAt(ctx context.Context, r io.ReaderAt) io.ReaderAt {
+	if c == nil {
+		return r
+	}
+	return &pausableReaderAt{ctx: ctx, control: c, r: r}
+}
+
+type pausableReaderAt struct {
+	ctx     context.Context
+	control *UploadControl
+	r       io.ReaderAt
+}
+
+func (p *pausableReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if !p.control.wait(p.ctx) {
+		return 0, cmp.Or(p.ctx.Err(), context.Canceled)
+	}
+	return p.r.ReadAt(b, off)
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,204 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubTransfer stands in for an upload attempt: it takes the files started through
+// begin, as placeItem does, and holds each until it is released or its context ends
+type stubTransfer struct {
+	run     *uploadRun
+	ctx     context.Context // The transfer context
+	mu      sync.Mutex
+	started []string
+	done    map[string]error
+	release chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newStubTransfer(run *uploadRun, ctx context.Context) *stubTransfer {
+	return &stubTransfer{run: run, ctx: ctx, done: make(map[string]error), release: make(chan struct{})}
+}
+
+// start transfers name in the background
+func (s *stubTransfer) start(name string) {
+	s.wg.Go(func() {
+		if !s.run.begin(s.ctx, false) {
+			return
+		}
+		defer s.run.release()
+		s.mu.Lock()
+		s.started = append(s.started, name)
+		s.mu.Unlock()
+
+		var err error
+		select {
+		case <-s.release:
+		case <-s.ctx.Done():
+			err = s.ctx.Err()
+		}
+		s.mu.Lock()
+		s.done[name] = err
+		s.mu.Unlock()
+	})
+}
+
+func (s *stubTransfer) startedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.started)
+}
+
+// waitStarted waits until n files have started
+func (s *stubTransfer) waitStarted(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.startedCount() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d transfers started, want %d", s.startedCount(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUploadControlPauseBlocksTransfers(t *testing.T) {
+	c := NewUploadControl()
+	intake, transfer, cancel := c.contexts(context.Background())
+	defer cancel()
+	stub := newStubTransfer(&uploadRun{control: c, limiter: newConcurrencyLimiter(4)}, transfer)
+
+	stub.start("running.jpg")
+	stub.waitStarted(t, 1)
+	c.Pause()
+	if !c.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	stub.start("queued.jpg")
+	time.Sleep(20 * time.Millisecond)
+	if n := stub.startedCount(); n != 1 {
+		t.Fatalf("%d transfers started while paused, want only the one running before", n)
+	}
+	if intake.Err() != nil || transfer.Err() != nil {
+		t.Fatal("pausing ended a context")
+	}
+
+	c.Resume()
+	stub.waitStarted(t, 2)
+	close(stub.release)
+	stub.wg.Wait()
+	for name, err := range stub.done {
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestUploadControlStop(t *testing.T) {
+	tests := []struct {
+		name      string
+		graceful  bool
+		paused    bool
+		wantError bool // In-flight transfers are aborted
+	}{
+		{"graceful stop drains in-flight transfers", true, false, false},
+		{"abort cancels in-flight transfers", false, false, true},
+		{"stop while paused", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewUploadControl()
+			intake, transfer, cancel := c.contexts(context.Background())
+			defer cancel()
+			run := &uploadRun{control: c, limiter: newConcurrencyLimiter(2)}
+			stub := newStubTransfer(run, transfer)
+
+			stub.start("a.jpg")
+			stub.start("b.jpg")
+			stub.waitStarted(t, 2)
+			stub.start("queued.jpg") // Waits for a slot
+			if tt.paused {
+				c.Pause()
+			}
+			c.Stop(tt.graceful)
+
+			select {
+			case <-intake.Done():
+			case <-time.After(2 * time.Second):
+				t.Fatal("intake not cancelled by Stop")
+			}
+			if c.Paused() {
+				t.Error("still paused after Stop")
+			}
+			if !tt.wantError {
+				if transfer.Err() != nil {
+					t.Fatal("graceful stop cancelled running transfers")
+				}
+				close(stub.release)
+			}
+			stub.wg.Wait()
+
+			// A started file's retry, or its Live Photo video, still runs after a graceful stop
+			if started := run.begin(transfer, true); started == tt.wantError {
+				t.Errorf("started file continues = %v, want %v", started, !tt.wantError)
+			} else if started {
+				run.release()
+			}
+
+			if got := strings.Join(stub.started, ","); stub.startedCount() != 2 {
+				t.Errorf("started %s, want only the files running before Stop", got)
+			}
+			if run.begin(transfer, false) {
+				t.Error("new file started after Stop")
+			}
+			for name, err := range stub.done {
+				if aborted := errors.Is(err, context.Canceled); aborted != tt.wantError {
+					t.Errorf("%s: error %v, want aborted %v", name, err, tt.wantError)
+				}
+			}
+			if len(stub.done) != 2 {
+				t.Errorf("%d transfers finished, want 2", len(stub.done))
+			}
+		})
+	}
+}
+
+func TestUploadControlPausedReader(t *testing.T) {
+	c := NewUploadControl()
+	_, transfer, cancel := c.contexts(context.Background())
+	defer cancel()
+	r := c.readerAt(transfer, strings.NewReader("jpeg"))
+
+	c.Pause()
+	read := make(chan error, 1)
+	go func() {
+		_, err := r.ReadAt(make([]byte, 4), 0)
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		t.Fatalf("read returned while paused: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// An abort ends reads held by a pause
+	c.Stop(false)
+	select {
+	case err := <-read:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("read error = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read still blocked after Stop(false)")
+	}
+
+	// Pausing a stopped upload does nothing
+	c.Pause()
+	if c.Paused() {
+		t.Error("Paused() = true after Stop")
+	}
+}
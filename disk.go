@@ -0,0 +1,134 @@
+package gpm
+
+import (
+	"io"
+	"sync"
+)
+
+// diskReadChunk is how much a reader gets to read per turn in serial disk mode
+const diskReadChunk = 8 * 1024 * 1024
+
+// diskGate serialises disk reads for UploadOptions.SerialDiskReads. Readers take
+// turns per chunk, so hashing a huge file doesn't stall transfers, while each turn
+// is one long sequential read instead of many small interleaved ones. Small metadata
+// reads, like sniffing and EXIF, take a turn of their own through do.
+// A nil gate doesn't restrict anything.
+type diskGate struct {
+	mu    sync.Mutex
+	chunk int       // Bytes read per turn, diskReadChunk if 0
+	bufs  sync.Pool // Chunk buffers, held by a reader only while it has unread data in one
+}
+
+// diskGate returns the client's gate if opts asks for serial reads, so concurrent
+// uploads take turns on the disk as well
+func (g *GooglePhotosAPI) diskGate(opts UploadOptions) *diskGate {
+	if !opts.SerialDiskReads {
+		return nil
+	}
+	return &g.disk
+}
+
+// do runs fn, which reads from disk, in a turn of its own
+func (g *diskGate) do(fn func()) {
+	if g == nil {
+		fn()
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fn()
+}
+
+// readerAt wraps r so its reads go through the gate
+func (g *diskGate) readerAt(r io.ReaderAt) io.ReaderAt {
+	if g == nil {
+		return r
+	}
+	return &gatedReaderAt{gate: g, r: r}
+}
+
+func (g *diskGate) chunkSize() int {
+	if g.chunk > 0 {
+		return g.chunk
+	}
+	return diskReadChunk
+}
+
+// getBuf returns a chunk buffer, reusing one released by another reader if it can
+func (g *diskGate) getBuf() []byte {
+	if b, ok := g.bufs.Get().(*[]byte); ok && len(*b) == g.chunkSize() {
+		return *b
+	}
+	return make([]byte, g.chunkSize())
+}
+
+func (g *diskGate) putBuf(b []byte) {
+	g.bufs.Put(&b)
+}
+
+// gatedReaderAt reads whole chunks under the gate and serves reads from the buffer.
+// It's built for the mostly sequential reads of hashing and upload bodies. The
+// buffer goes back to the gate once its data is used up, so finished and waiting
+// readers hold none.
+type gatedReaderAt struct {
+	gate *diskGate
+	r    io.ReaderAt
+
+	mu  sync.Mutex // A cancelled request's body may still be read while the next one starts
+	buf []byte     // nil once the chunk is used up
+	off int64      // Offset of buf[0] in r
+	n   int        // Valid bytes in buf
+	err error      // Error that ended the buffered chunk, returned once its data is used up
+}
+
+func (c *gatedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for total < len(p) {
+		end := c.off + int64(c.n)
+		if off < c.off || off > end || (off == end && c.err == nil) {
+			c.fill(off)
+			end = c.off + int64(c.n)
+		}
+		if off == end {
+			return total, c.err
+		}
+		k := copy(p[total:], c.buf[off-c.off:c.n])
+		total += k
+		off += int64(k)
+		if off == end {
+			c.release()
+		}
+	}
+	return total, nil
+}
+
+// fill reads the chunk starting at off
+func (c *gatedReaderAt) fill(off int64) {
+	if c.buf == nil {
+		c.buf = c.gate.getBuf()
+	}
+	c.gate.mu.Lock()
+	n, err := c.r.ReadAt(c.buf, off)
+	c.gate.mu.Unlock()
+	if n == len(c.buf) {
+		// A full chunk may come with io.EOF, the next read reports it
+		err = nil
+	}
+	c.off, c.n, c.err = off, n, err
+	if n == 0 {
+		c.release()
+	}
+}
+
+// release hands the used up buffer back to the gate, keeping the position after it
+func (c *gatedReaderAt) release() {
+	if c.buf == nil {
+		return
+	}
+	c.gate.putBuf(c.buf)
+	c.buf = nil
+	c.off, c.n = c.off+int64(c.n), 0
+}
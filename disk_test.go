@@ -0,0 +1,104 @@
+package gpm
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGatedReaderAt(t *testing.T) {
+	type read struct {
+		off int64
+		n   int
+	}
+	sequential := func(size, n int) []read {
+		var reads []read
+		for off := 0; off <= size; off += n {
+			reads = append(reads, read{int64(off), n})
+		}
+		return reads
+	}
+	tests := []struct {
+		name  string
+		size  int
+		reads []read
+	}{
+		{"small reads", 100, sequential(100, 7)},
+		{"chunk-sized reads", 100, sequential(100, 16)},
+		{"reads spanning chunks", 100, sequential(100, 40)},
+		{"size a multiple of the chunk", 64, sequential(64, 16)},
+		{"empty file", 0, []read{{0, 10}}},
+		{"seek back", 100, []read{{0, 30}, {50, 10}, {5, 20}, {90, 20}}},
+		{"past the end", 100, []read{{100, 5}, {120, 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			want := bytes.NewReader(data)
+			r := (&diskGate{chunk: 16}).readerAt(want).(*gatedReaderAt)
+
+			for _, rd := range tt.reads {
+				got, wantBuf := make([]byte, rd.n), make([]byte, rd.n)
+				n, err := r.ReadAt(got, rd.off)
+				wantN, wantErr := want.ReadAt(wantBuf, rd.off)
+				if n != wantN || !bytes.Equal(got[:n], wantBuf[:wantN]) || (err == nil) != (wantErr == nil) {
+					t.Fatalf("ReadAt(%d bytes at %d) = %d, %v, want %d, %v", rd.n, rd.off, n, err, wantN, wantErr)
+				}
+			}
+			// A reader at the end of its data holds no buffer
+			if r.n == 0 && r.buf != nil {
+				t.Error("buffer kept after its data was used up")
+			}
+		})
+	}
+}
+
+// overlapTracker is an io.ReaderAt that records how many reads run at once
+type overlapTracker struct {
+	data   []byte
+	active atomic.Int32
+	most   atomic.Int32
+}
+
+func (o *overlapTracker) ReadAt(p []byte, off int64) (int, error) {
+	n := o.active.Add(1)
+	defer o.active.Add(-1)
+	for {
+		most := o.most.Load()
+		if n <= most || o.most.CompareAndSwap(most, n) {
+			break
+		}
+	}
+	time.Sleep(100 * time.Microsecond)
+	return bytes.NewReader(o.data).ReadAt(p, off)
+}
+
+func TestDiskGateReadsDontOverlap(t *testing.T) {
+	gate := &diskGate{chunk: 64}
+	disk := &overlapTracker{data: make([]byte, 1024)}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		// Hashing and transfers reading whole files in small pieces
+		wg.Go(func() {
+			io.Copy(io.Discard, io.NewSectionReader(gate.readerAt(disk), 0, int64(len(disk.data))))
+		})
+		// Metadata reads like sniffing and EXIF
+		wg.Go(func() {
+			for range 8 {
+				gate.do(func() { disk.ReadAt(make([]byte, 16), 0) })
+			}
+		})
+	}
+	wg.Wait()
+
+	if most := disk.most.Load(); most != 1 {
+		t.Errorf("%d reads ran at once, want 1", most)
+	}
+}
@@ -0,0 +1,130 @@
+package gpm
+
+import "sync"
+
+// duplicateTracker makes sure identical files within one Upload are uploaded once.
+// The first copy of each hash to finish hashing is uploaded; copies that follow while
+// it is in flight wait for it and are then reported as skipped with its media key. If
+// it fails, the next copy is tried instead. Hashes are forgotten once settled, copies
+// found later are caught by the existence check like any file already in the library.
+type duplicateTracker struct {
+	mu      sync.Mutex
+	entries map[string]*duplicateEntry // Hashes with a copy in flight, by dedup key
+
+	// Every hash seen and the paths found for it, only kept to report groups
+	report bool
+	seen   map[string]*DuplicateGroup
+	order  []string // Dedup keys in the order first seen
+}
+
+type duplicateEntry struct {
+	winner  string       // Path of the copy being uploaded
+	waiting []uploadItem // Copies waiting for the winner
+}
+
+// DuplicateGroup is a set of identical local files, see UploadOptions.ReportDuplicates
+type DuplicateGroup struct {
+	DedupKey string
+	MediaKey string   // Library item the files match, empty if none made it
+	Paths    []string // In the order found
+}
+
+// newDuplicateTracker returns a tracker that also remembers every path it sees if report is set
+func newDuplicateTracker(report bool) *duplicateTracker {
+	t := &duplicateTracker{entries: make(map[string]*duplicateEntry), report: report}
+	if report {
+		t.seen = make(map[string]*DuplicateGroup)
+	}
+	return t
+}
+
+// claim registers a hashed item and reports whether it goes on to the existence
+// check. Copies of content that is still being uploaded are held back. Live Photos
+// are never held.
+func (t *duplicateTracker) claim(item *uploadItem) bool {
+	if t == nil || item.video != nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.report {
+		group, ok := t.seen[item.dedupKey]
+		if !ok {
+			group = &DuplicateGroup{DedupKey: item.dedupKey}
+			t.seen[item.dedupKey] = group
+			t.order = append(t.order, item.dedupKey)
+		}
+		group.Paths = append(group.Paths, item.source)
+	}
+	entry, ok := t.entries[item.dedupKey]
+	if !ok {
+		t.entries[item.dedupKey] = &duplicateEntry{winner: item.source}
+		return true
+	}
+	entry.waiting = append(entry.waiting, *item)
+	return false
+}
+
+// resolve records that the winner of item's hash is in the library under mediaKey
+// and returns the copies that waited for it, marked as duplicates
+func (t *duplicateTracker) resolve(item uploadItem, mediaKey string) []uploadItem {
+	if t == nil || item.duplicateOf != "" || mediaKey == "" {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[item.dedupKey]
+	if !ok || entry.winner != item.source {
+		return nil
+	}
+	delete(t.entries, item.dedupKey)
+	if group := t.seen[item.dedupKey]; group != nil {
+		group.MediaKey = mediaKey
+	}
+	for i := range entry.waiting {
+		entry.waiting[i].existing, entry.waiting[i].duplicateOf = mediaKey, entry.winner
+	}
+	return entry.waiting
+}
+
+// fail records that the winner of item's hash failed and returns the copy to try
+// next, if one is waiting
+func (t *duplicateTracker) fail(item uploadItem) (uploadItem, bool) {
+	if t == nil || item.duplicateOf != "" {
+		return uploadItem{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[item.dedupKey]
+	if !ok || entry.winner != item.source {
+		return uploadItem{}, false
+	}
+	if len(entry.waiting) == 0 {
+		delete(t.entries, item.dedupKey)
+		return uploadItem{}, false
+	}
+	next := entry.waiting[0]
+	entry.waiting = entry.waiting[1:]
+	entry.winner = next.source
+	return next, true
+}
+
+// groups returns the hashes found more than once, empty unless the tracker reports
+func (t *duplicateTracker) groups() []DuplicateGroup {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var groups []DuplicateGroup
+	for _, key := range t.order {
+		if group := t.seen[key]; len(group.Paths) > 1 {
+			groups = append(groups, *group)
+		}
+	}
+	return groups
+}
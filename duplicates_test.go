@@ -0,0 +1,173 @@
+package gpm
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDuplicateTrackerConcurrentCopies(t *testing.T) {
+	tracker := newDuplicateTracker(true)
+	items := []uploadItem{
+		{source: "a/IMG_0001.JPG", dedupKey: "k1"},
+		{source: "b/IMG_0001.JPG", dedupKey: "k1"},
+		{source: "c/IMG_0001.JPG", dedupKey: "k1"},
+	}
+
+	var mu sync.Mutex
+	var winners []uploadItem
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tracker.claim(&item) {
+				mu.Lock()
+				winners = append(winners, item)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(winners) != 1 {
+		t.Fatalf("%d copies went on to upload, want 1", len(winners))
+	}
+
+	winner := winners[0]
+	waiting := tracker.resolve(winner, "media1")
+	if len(waiting) != 2 {
+		t.Fatalf("resolve returned %d waiting copies, want 2", len(waiting))
+	}
+	for _, item := range waiting {
+		if item.existing != "media1" || item.duplicateOf != winner.source {
+			t.Errorf("waiting copy %s: existing %q duplicateOf %q", item.source, item.existing, item.duplicateOf)
+		}
+		// Skipping a duplicate resolves nothing further
+		if more := tracker.resolve(item, item.existing); more != nil {
+			t.Errorf("resolving duplicate %s returned %v", item.source, more)
+		}
+	}
+	if len(tracker.entries) != 0 {
+		t.Errorf("tracker still holds %d entries after resolving", len(tracker.entries))
+	}
+
+	groups := tracker.groups()
+	if len(groups) != 1 || groups[0].MediaKey != "media1" || len(groups[0].Paths) != 3 {
+		t.Fatalf("groups() = %+v", groups)
+	}
+	for _, item := range items {
+		if !slices.Contains(groups[0].Paths, item.source) {
+			t.Errorf("group is missing %s", item.source)
+		}
+	}
+}
+
+func TestDuplicateTracker(t *testing.T) {
+	type step struct {
+		op   string // claim, resolve or fail
+		path string
+		want string // claim: "pass" or "hold"; resolve: waiting paths; fail: next path
+	}
+	tests := []struct {
+		name       string
+		report     bool
+		steps      []step
+		wantGroups int
+	}{
+		{
+			name:   "unique files pass",
+			report: true,
+			steps: []step{
+				{"claim", "a", "pass"},
+				{"resolve", "a", ""},
+			},
+		},
+		{
+			name:   "second copy waits for the first",
+			report: true,
+			steps: []step{
+				{"claim", "a", "pass"},
+				{"claim", "b", "hold"},
+				{"resolve", "a", "b"},
+			},
+			wantGroups: 1,
+		},
+		{
+			name:   "next copy takes over after a failure",
+			report: true,
+			steps: []step{
+				{"claim", "a", "pass"},
+				{"claim", "b", "hold"},
+				{"claim", "c", "hold"},
+				{"fail", "a", "b"},
+				{"resolve", "b", "c"},
+			},
+			wantGroups: 1,
+		},
+		{
+			name:   "copy after a lone failure uploads",
+			report: true,
+			steps: []step{
+				{"claim", "a", "pass"},
+				{"fail", "a", ""},
+				{"claim", "b", "pass"},
+			},
+			wantGroups: 1,
+		},
+		{
+			name:   "copy after the winner settled goes to the existence check",
+			report: true,
+			steps: []step{
+				{"claim", "a", "pass"},
+				{"resolve", "a", ""},
+				{"claim", "b", "pass"},
+				{"resolve", "b", ""},
+			},
+			wantGroups: 1,
+		},
+		{
+			name: "groups are only kept when reporting",
+			steps: []step{
+				{"claim", "a", "pass"},
+				{"claim", "b", "hold"},
+				{"resolve", "a", "b"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newDuplicateTracker(tt.report)
+			for i, s := range tt.steps {
+				item := uploadItem{source: s.path, dedupKey: "k"}
+				var got string
+				switch s.op {
+				case "claim":
+					got = "hold"
+					if tracker.claim(&item) {
+						got = "pass"
+					}
+				case "resolve":
+					var paths []string
+					for _, w := range tracker.resolve(item, "media") {
+						paths = append(paths, w.source)
+					}
+					got = strings.Join(paths, ",")
+				case "fail":
+					if next, ok := tracker.fail(item); ok {
+						got = next.source
+					}
+				}
+				if got != s.want {
+					t.Fatalf("step %d %s(%s) = %q, want %q", i, s.op, s.path, got, s.want)
+				}
+			}
+			if got := len(tracker.groups()); got != tt.wantGroups {
+				t.Errorf("len(groups()) = %d, want %d", got, tt.wantGroups)
+			}
+			if !tt.report && (tracker.seen != nil || tracker.order != nil) {
+				t.Errorf("tracker kept paths without reporting")
+			}
+		})
+	}
+}
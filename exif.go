@@ -0,0 +1,624 @@
+package gpm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// TimestampSource selects which timestamp is committed as the item's date
+type TimestampSource string
+
+const (
+	TimestampMtime TimestampSource = "mtime" // File modification time (default)
+	TimestampExif  TimestampSource = "exif"  // Embedded capture time, mtime if the file has none
+	TimestampAuto  TimestampSource = "auto"  // Embedded capture time when plausible, otherwise mtime
+)
+
+// quickTimeEpochOffset is the number of seconds between 1904-01-01 and 1970-01-01
+const quickTimeEpochOffset = 2082844800
+
+// EXIF tags used when reading metadata
+const (
+	tagMake              = 0x010F
+	tagModel             = 0x0110
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+	tagOffsetTimeOrig    = 0x9011
+	tagMakerNote         = 0x927C
+
+	appleTagContentIdentifier = 0x0011 // In the Apple maker note
+)
+
+// quickTimeContentIdentifier is the metadata key Apple pairs Live Photo videos by
+const quickTimeContentIdentifier = "com.apple.quicktime.content.identifier"
+
+// MediaMetadata holds the embedded metadata read from a media file
+type MediaMetadata struct {
+	CaptureTime time.Time // EXIF DateTimeOriginal or QuickTime creation time, zero if absent
+	Make        string    // Camera manufacturer
+	Model       string    // Camera model
+
+	// ContentIdentifier is the ID Apple writes into both halves of a Live Photo,
+	// empty for other files
+	ContentIdentifier string
+}
+
+// ReadMediaMetadata extracts capture time, camera info and the Live Photo ID from JPEG, HEIC/AVIF,
+// TIFF-based RAW and MP4/MOV files. Other formats return empty metadata.
+func ReadMediaMetadata(path string) (*MediaMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	header := make([]byte, sniffLen)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	meta := &MediaMetadata{}
+	var parseErr error
+	switch mediaType := sniffMediaType(header[:n], fileExt(path)); mediaType {
+	case "image/jpeg":
+		parseErr = readJPEGMetadata(io.NewSectionReader(file, 0, size), meta)
+	case "image/x-fuji-raf":
+		parseErr = readRAFMetadata(file, size, meta)
+	case "image/tiff", "image/x-canon-cr2", "image/x-nikon-nef", "image/x-sony-arw", "image/x-olympus-orf",
+		"image/x-panasonic-rw2", "image/x-pentax-pef", "image/x-sony-sr2", "image/x-adobe-dng":
+		parseErr = readTIFFMetadata(io.NewSectionReader(file, 0, size), meta)
+	case "image/heic", "image/heif", "image/avif", "image/x-canon-cr3",
+		"video/mp4", "video/quicktime", "video/3gpp", "video/3gpp2", "video/x-m4v":
+		parseErr = readISOBMFFMetadata(file, size, meta)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", parseErr)
+	}
+	return meta, nil
+}
+
+// resolveTimestamp picks the timestamp to commit for a file according to source
+func resolveTimestamp(path string, mtime time.Time, source TimestampSource) time.Time {
+	if source != TimestampExif && source != TimestampAuto {
+		return mtime
+	}
+	meta, err := ReadMediaMetadata(path)
+	if err != nil || meta.CaptureTime.IsZero() {
+		return mtime
+	}
+	if source == TimestampAuto && !plausibleCaptureTime(meta.CaptureTime) {
+		return mtime
+	}
+	return meta.CaptureTime
+}
+
+// plausibleCaptureTime rejects unset camera clocks and dates in the future
+func plausibleCaptureTime(t time.Time) bool {
+	return t.Year() >= 1970 && t.Before(time.Now().Add(24*time.Hour))
+}
+
+// readJPEGMetadata walks JPEG markers up to the image data looking for an APP1 Exif segment
+func readJPEGMetadata(r *io.SectionReader, meta *MediaMetadata) error {
+	var pos int64 = 2 // Skip SOI
+	buf := make([]byte, 4)
+	for {
+		if _, err := r.ReadAt(buf, pos); err != nil {
+			return nil
+		}
+		if buf[0] != 0xFF {
+			return nil
+		}
+		marker := buf[1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // Start of scan or end of image
+			return nil
+		}
+		segLen := int64(binary.BigEndian.Uint16(buf[2:4]))
+		if segLen < 2 {
+			return nil
+		}
+		if marker == 0xE1 && segLen > 8 {
+			magic := make([]byte, 6)
+			if _, err := r.ReadAt(magic, pos+4); err == nil && string(magic) == "Exif\x00\x00" {
+				return readTIFFMetadata(io.NewSectionReader(r, pos+10, segLen-8), meta)
+			}
+		}
+		pos += 2 + segLen
+	}
+}
+
+// readRAFMetadata reads the EXIF of the preview JPEG embedded in a Fujifilm RAF file
+func readRAFMetadata(r io.ReaderAt, size int64, meta *MediaMetadata) error {
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf, 84); err != nil {
+		return nil
+	}
+	offset := int64(binary.BigEndian.Uint32(buf[0:4]))
+	length := int64(binary.BigEndian.Uint32(buf[4:8]))
+	if offset <= 0 || length <= 0 || offset+length > size {
+		return nil
+	}
+	return readJPEGMetadata(io.NewSectionReader(r, offset, length), meta)
+}
+
+// ifdEntry is a single 12-byte TIFF directory entry
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // Raw 4-byte value or offset field
+}
+
+// tiffReader reads directories from a TIFF structure (also used inside EXIF blocks)
+type tiffReader struct {
+	r     *io.SectionReader
+	order binary.ByteOrder
+}
+
+func (t *tiffReader) readIFD(offset int64) ([]ifdEntry, error) {
+	buf := make([]byte, 2)
+	if _, err := t.r.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	count := int(t.order.Uint16(buf))
+	if count == 0 || count > 1000 {
+		return nil, errors.New("invalid IFD entry count")
+	}
+
+	data := make([]byte, count*12)
+	if _, err := t.r.ReadAt(data, offset+2); err != nil {
+		return nil, err
+	}
+	entries := make([]ifdEntry, count)
+	for i := range entries {
+		e := data[i*12 : (i+1)*12]
+		entries[i] = ifdEntry{
+			tag:   t.order.Uint16(e[0:2]),
+			typ:   t.order.Uint16(e[2:4]),
+			count: t.order.Uint32(e[4:8]),
+			value: e[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// readString returns an ASCII entry's value without trailing NULs and spaces
+func (t *tiffReader) readString(e ifdEntry) string {
+	if e.typ != 2 || e.count == 0 || e.count > 256 {
+		return ""
+	}
+	data := e.value[:min(int(e.count), 4)]
+	if e.count > 4 {
+		data = make([]byte, e.count)
+		if _, err := t.r.ReadAt(data, int64(t.order.Uint32(e.value))); err != nil {
+			return ""
+		}
+	}
+	return strings.TrimRight(string(data), "\x00 ")
+}
+
+// readAppleContentIdentifier reads the Live Photo ID from an Apple maker note: "Apple iOS\0",
+// a version and the byte order, then an IFD whose offsets start at the note
+func (t *tiffReader) readAppleContentIdentifier(e ifdEntry) string {
+	if e.count < 16 || e.count > 64*1024 {
+		return ""
+	}
+	note := io.NewSectionReader(t.r, int64(t.order.Uint32(e.value)), int64(e.count))
+	header := make([]byte, 14)
+	if _, err := note.ReadAt(header, 0); err != nil || string(header[:10]) != "Apple iOS\x00" {
+		return ""
+	}
+	apple := &tiffReader{r: note, order: binary.BigEndian}
+	if string(header[12:14]) == "II" {
+		apple.order = binary.LittleEndian
+	}
+	entries, err := apple.readIFD(14)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.tag == appleTagContentIdentifier {
+			return apple.readString(entry)
+		}
+	}
+	return ""
+}
+
+// readTIFFMetadata parses a TIFF header, IFD0 and the EXIF sub-IFD
+// Non-standard magic numbers (ORF, RW2) are accepted since only the byte order matters
+func readTIFFMetadata(r *io.SectionReader, meta *MediaMetadata) error {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil
+	}
+	t := &tiffReader{r: r}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errors.New("invalid TIFF byte order")
+	}
+
+	ifd0, err := t.readIFD(int64(t.order.Uint32(header[4:8])))
+	if err != nil {
+		return nil
+	}
+
+	var dateTime, original, digitized, offset string
+	var exifOffset uint32
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagMake:
+			meta.Make = t.readString(e)
+		case tagModel:
+			meta.Model = t.readString(e)
+		case tagDateTime:
+			dateTime = t.readString(e)
+		case tagExifIFD:
+			exifOffset = t.order.Uint32(e.value)
+		}
+	}
+	if exifOffset != 0 {
+		if exif, err := t.readIFD(int64(exifOffset)); err == nil {
+			for _, e := range exif {
+				switch e.tag {
+				case tagDateTimeOriginal:
+					original = t.readString(e)
+				case tagDateTimeDigitized:
+					digitized = t.readString(e)
+				case tagOffsetTimeOrig:
+					offset = t.readString(e)
+				case tagMakerNote:
+					meta.ContentIdentifier = t.readAppleContentIdentifier(e)
+				}
+			}
+		}
+	}
+
+	for _, s := range []string{original, digitized, dateTime} {
+		if ts := parseExifTime(s, offset); !ts.IsZero() {
+			meta.CaptureTime = ts
+			break
+		}
+	}
+	return nil
+}
+
+// parseExifTime parses "YYYY:MM:DD HH:MM:SS", using the EXIF offset ("+02:00") if present
+// and local time otherwise, as cameras record wall-clock time
+func parseExifTime(s, offset string) time.Time {
+	if len(s) < 19 || strings.HasPrefix(s, "0000") {
+		return time.Time{}
+	}
+	s = s[:19]
+	if len(offset) == 6 {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", s+offset); err == nil {
+			return t
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// walkBoxes calls fn for each ISO-BMFF box between start and end
+// fn receives the box type and the byte range of its payload
+func walkBoxes(r io.ReaderAt, start, end int64, fn func(boxType string, bodyStart, bodyEnd int64) error) error {
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return nil
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := string(header[4:8])
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return nil
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || pos+size > end {
+			return nil
+		}
+		if err := fn(boxType, pos+headerLen, pos+size); err != nil {
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+// readISOBMFFMetadata reads EXIF from a HEIF meta box or the creation time from a movie header
+func readISOBMFFMetadata(r io.ReaderAt, size int64, meta *MediaMetadata) error {
+	var movieTime time.Time
+	err := walkBoxes(r, 0, size, func(boxType string, start, end int64) error {
+		switch boxType {
+		case "meta":
+			// meta is a full box: skip version and flags
+			if exifStart, exifEnd, ok := findHEIFExif(r, start+4, end); ok {
+				readHEIFExif(r, exifStart, exifEnd, meta)
+			}
+		case "moov":
+			movieTime = readMovieCreationTime(r, start, end)
+			meta.ContentIdentifier = readQuickTimeContentIdentifier(r, start, end)
+		}
+		return nil
+	})
+	if meta.CaptureTime.IsZero() {
+		meta.CaptureTime = movieTime
+	}
+	return err
+}
+
+// readMovieCreationTime returns the mvhd creation time inside a moov box
+func readMovieCreationTime(r io.ReaderAt, start, end int64) time.Time {
+	var created time.Time
+	walkBoxes(r, start, end, func(boxType string, bodyStart, bodyEnd int64) error {
+		if boxType != "mvhd" {
+			return nil
+		}
+		buf := make([]byte, 12)
+		if _, err := r.ReadAt(buf, bodyStart); err != nil {
+			return nil
+		}
+		var secs uint64
+		if buf[0] == 1 {
+			secs = binary.BigEndian.Uint64(buf[4:12])
+		} else {
+			secs = uint64(binary.BigEndian.Uint32(buf[4:8]))
+		}
+		// Zero means unset; QuickTime times are UTC
+		if secs > quickTimeEpochOffset {
+			created = time.Unix(int64(secs-quickTimeEpochOffset), 0).UTC()
+		}
+		return nil
+	})
+	return created
+}
+
+// readQuickTimeContentIdentifier returns the Live Photo ID from the metadata of a moov box
+func readQuickTimeContentIdentifier(r io.ReaderAt, start, end int64) string {
+	var id string
+	walkBoxes(r, start, end, func(boxType string, bodyStart, bodyEnd int64) error {
+		if boxType == "meta" && id == "" {
+			id = readQuickTimeMetadataItem(r, bodyStart, bodyEnd, quickTimeContentIdentifier)
+		}
+		return nil
+	})
+	return id
+}
+
+// readQuickTimeMetadataItem returns the string value of key from a QuickTime meta box,
+// where a keys box names the items and an ilst box holds them by 1-based index
+func readQuickTimeMetadataItem(r io.ReaderAt, start, end int64, key string) string {
+	// Unlike the ISO meta box, the QuickTime one usually has no version and flags
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return ""
+	}
+	if string(buf[4:8]) != "hdlr" {
+		start += 4
+	}
+	var index uint32
+	var ilstStart, ilstEnd int64
+	walkBoxes(r, start, end, func(boxType string, bodyStart, bodyEnd int64) error {
+		switch boxType {
+		case "keys":
+			index = findQuickTimeKey(r, bodyStart, bodyEnd, key)
+		case "ilst":
+			ilstStart, ilstEnd = bodyStart, bodyEnd
+		}
+		return nil
+	})
+	if index == 0 || ilstStart == 0 {
+		return ""
+	}
+
+	var value string
+	walkBoxes(r, ilstStart, ilstEnd, func(boxType string, bodyStart, bodyEnd int64) error {
+		if binary.BigEndian.Uint32([]byte(boxType)) != index {
+			return nil
+		}
+		walkBoxes(r, bodyStart, bodyEnd, func(dataType string, dataStart, dataEnd int64) error {
+			// A data box holds a type indicator, a locale and the value; type 1 is UTF-8
+			if dataType != "data" || dataEnd-dataStart < 8 || dataEnd-dataStart > 8+256 {
+				return nil
+			}
+			data := make([]byte, dataEnd-dataStart)
+			if _, err := r.ReadAt(data, dataStart); err == nil && binary.BigEndian.Uint32(data[0:4]) == 1 {
+				value = string(data[8:])
+			}
+			return nil
+		})
+		return nil
+	})
+	return value
+}
+
+// findQuickTimeKey returns the 1-based index of key in a keys box, 0 if it isn't there
+func findQuickTimeKey(r io.ReaderAt, start, end int64, key string) uint32 {
+	data := make([]byte, min(end-start, 64*1024))
+	if _, err := r.ReadAt(data, start); err != nil && err != io.EOF {
+		return 0
+	}
+	pos := 8 // Version, flags and entry count
+	for index := uint32(1); pos+8 <= len(data); index++ {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if size < 8 || pos+size > len(data) {
+			return 0
+		}
+		if string(data[pos+4:pos+8]) == "mdta" && string(data[pos+8:pos+size]) == key {
+			return index
+		}
+		pos += size
+	}
+	return 0
+}
+
+// findHEIFExif locates the Exif item's data through the iinf and iloc boxes
+func findHEIFExif(r io.ReaderAt, start, end int64) (int64, int64, bool) {
+	var exifID uint32
+	var ilocStart, ilocEnd int64
+	walkBoxes(r, start, end, func(boxType string, bodyStart, bodyEnd int64) error {
+		switch boxType {
+		case "iinf":
+			exifID = findExifItemID(r, bodyStart, bodyEnd)
+		case "iloc":
+			ilocStart, ilocEnd = bodyStart, bodyEnd
+		}
+		return nil
+	})
+	if exifID == 0 || ilocStart == 0 {
+		return 0, 0, false
+	}
+	return findItemLocation(r, ilocStart, ilocEnd, exifID)
+}
+
+// findExifItemID scans infe entries of an iinf box for the item of type "Exif"
+func findExifItemID(r io.ReaderAt, start, end int64) uint32 {
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return 0
+	}
+	entriesStart := start + 6 // version, flags, 16-bit entry count
+	if buf[0] != 0 {
+		entriesStart = start + 8
+	}
+
+	var id uint32
+	walkBoxes(r, entriesStart, end, func(boxType string, bodyStart, bodyEnd int64) error {
+		if boxType != "infe" || id != 0 {
+			return nil
+		}
+		data := make([]byte, min(bodyEnd-bodyStart, 16))
+		if _, err := r.ReadAt(data, bodyStart); err != nil || len(data) < 12 {
+			return nil
+		}
+		switch data[0] { // Only versions 2 and 3 carry an item type
+		case 2:
+			if string(data[8:12]) == "Exif" {
+				id = uint32(binary.BigEndian.Uint16(data[4:6]))
+			}
+		case 3:
+			if len(data) >= 14 && string(data[10:14]) == "Exif" {
+				id = binary.BigEndian.Uint32(data[4:8])
+			}
+		}
+		return nil
+	})
+	return id
+}
+
+// findItemLocation returns the byte range of the first extent of itemID from an iloc box
+func findItemLocation(r io.ReaderAt, start, end int64, itemID uint32) (int64, int64, bool) {
+	data := make([]byte, min(end-start, 64*1024))
+	if _, err := r.ReadAt(data, start); err != nil && err != io.EOF {
+		return 0, 0, false
+	}
+	p := &byteParser{data: data}
+
+	version := p.uint(1)
+	p.skip(3)
+	sizes := p.uint(2)
+	offsetSize, lengthSize := int(sizes>>12&0xF), int(sizes>>8&0xF)
+	baseOffsetSize, indexSize := int(sizes>>4&0xF), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	itemCount := p.uint(idSize)
+
+	for i := uint64(0); i < itemCount && p.ok(); i++ {
+		id := p.uint(idSize)
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = p.uint(2) & 0xF
+		}
+		p.skip(2) // Data reference index
+		base := p.uint(baseOffsetSize)
+		extents := p.uint(2)
+		for e := uint64(0); e < extents && p.ok(); e++ {
+			p.skip(indexSize)
+			offset := p.uint(offsetSize)
+			length := p.uint(lengthSize)
+			if id == uint64(itemID) && e == 0 && method == 0 && p.ok() {
+				return int64(base + offset), int64(base + offset + length), length > 0
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// readHEIFExif parses an Exif item: a 4-byte offset to the TIFF header followed by the EXIF block
+func readHEIFExif(r io.ReaderAt, start, end int64, meta *MediaMetadata) {
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return
+	}
+	tiffStart := start + 4 + int64(binary.BigEndian.Uint32(buf))
+	if tiffStart >= end {
+		return
+	}
+	readTIFFMetadata(io.NewSectionReader(r, tiffStart, end-tiffStart), meta)
+}
+
+// byteParser reads big-endian integers of arbitrary width, tracking overruns
+type byteParser struct {
+	data []byte
+	pos  int
+	bad  bool
+}
+
+func (p *byteParser) ok() bool { return !p.bad }
+
+func (p *byteParser) skip(n int) {
+	p.pos += n
+	if p.pos > len(p.data) {
+		p.bad = true
+	}
+}
+
+func (p *byteParser) uint(n int) uint64 {
+	if n == 0 || p.bad {
+		return 0
+	}
+	if p.pos+n > len(p.data) {
+		p.bad = true
+		return 0
+	}
+	var v uint64
+	for _, b := range p.data[p.pos : p.pos+n] {
+		v = v<<8 | uint64(b)
+	}
+	p.pos += n
+	return v
+}
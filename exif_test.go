@@ -0,0 +1,346 @@
+package gpm
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tiffEntry is a directory entry for buildTIFF; data holds the raw value
+type tiffEntry struct {
+	tag, typ uint16
+	data     []byte
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag: tag, typ: 2, data: append([]byte(s), 0)}
+}
+
+// buildTIFF lays out a TIFF header, IFD0 and, if exif is set, an EXIF sub-IFD
+func buildTIFF(order binary.ByteOrder, ifd0, exif []tiffEntry) []byte {
+	if exif != nil {
+		ifd0 = append(ifd0, tiffEntry{tag: tagExifIFD, typ: 4})
+	}
+	ifdLen := func(entries []tiffEntry) int { return 2 + 12*len(entries) + 4 }
+	exifOffset := 8 + ifdLen(ifd0)
+	dataOffset := exifOffset
+	if exif != nil {
+		dataOffset += ifdLen(exif)
+	}
+
+	buf := make([]byte, dataOffset)
+	if order == binary.LittleEndian {
+		copy(buf, "II*\x00")
+	} else {
+		copy(buf, "MM\x00*")
+	}
+	order.PutUint32(buf[4:], 8)
+
+	var extra []byte
+	writeIFD := func(offset int, entries []tiffEntry) {
+		order.PutUint16(buf[offset:], uint16(len(entries)))
+		for i, e := range entries {
+			p := buf[offset+2+12*i:]
+			order.PutUint16(p[0:], e.tag)
+			order.PutUint16(p[2:], e.typ)
+			switch {
+			case e.tag == tagExifIFD && e.data == nil:
+				order.PutUint32(p[4:], 1)
+				order.PutUint32(p[8:], uint32(exifOffset))
+			case len(e.data) <= 4:
+				order.PutUint32(p[4:], uint32(len(e.data)))
+				copy(p[8:12], e.data)
+			default:
+				order.PutUint32(p[4:], uint32(len(e.data)))
+				order.PutUint32(p[8:], uint32(dataOffset+len(extra)))
+				extra = append(extra, e.data...)
+			}
+		}
+	}
+	writeIFD(8, ifd0)
+	if exif != nil {
+		writeIFD(exifOffset, exif)
+	}
+	return append(buf, extra...)
+}
+
+// appleMakerNote builds an Apple maker note carrying a Live Photo ID
+func appleMakerNote(id string) []byte {
+	note := []byte("Apple iOS\x00\x00\x01MM")
+	note = binary.BigEndian.AppendUint16(note, 1)
+	note = binary.BigEndian.AppendUint16(note, appleTagContentIdentifier)
+	note = binary.BigEndian.AppendUint16(note, 2)
+	note = binary.BigEndian.AppendUint32(note, uint32(len(id)+1))
+	note = binary.BigEndian.AppendUint32(note, 14+2+12+4)
+	note = binary.BigEndian.AppendUint32(note, 0)
+	return append(note, id+"\x00"...)
+}
+
+// buildJPEG wraps a TIFF block in an APP1 Exif segment
+func buildJPEG(tiff []byte) []byte {
+	b := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00} // SOI and an empty APP0
+	b = append(b, 0xFF, 0xE1)
+	b = binary.BigEndian.AppendUint16(b, uint16(2+6+len(tiff)))
+	b = append(b, "Exif\x00\x00"...)
+	b = append(b, tiff...)
+	return append(b, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9)
+}
+
+func box(kind string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := append(binary.BigEndian.AppendUint32(nil, uint32(size)), kind...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// buildHEIC stores a TIFF block as the Exif item of a HEIF file
+func buildHEIC(tiff []byte) []byte {
+	head := ftyp("heic", "mif1", "heic")
+	meta := func(offset uint32) []byte {
+		infe := box("infe", []byte{2, 0, 0, 0}, u16(1), u16(0), []byte("Exif\x00"))
+		iinf := box("iinf", []byte{0, 0, 0, 0}, u16(1), infe)
+		iloc := box("iloc", []byte{0, 0, 0, 0}, u16(0x4400), u16(1),
+			u16(1), u16(0), u16(1), u32(offset), u32(uint32(4+len(tiff))))
+		return box("meta", []byte{0, 0, 0, 0}, box("hdlr", make([]byte, 24)), iinf, iloc)
+	}
+	offset := uint32(len(head) + len(meta(0)) + 8)
+	file := append(head, meta(offset)...)
+	return append(file, box("mdat", u32(0), tiff)...)
+}
+
+// buildMOV builds a QuickTime movie with a creation time and a Live Photo ID
+func buildMOV(created time.Time, id string) []byte {
+	mvhd := append([]byte{0, 0, 0, 0}, u32(uint32(created.Unix()+quickTimeEpochOffset))...)
+	mvhd = append(mvhd, make([]byte, 92)...)
+	key := box("mdta", []byte(quickTimeContentIdentifier))
+	keys := box("keys", []byte{0, 0, 0, 0}, u32(1), key)
+	data := box("data", u32(1), u32(0), []byte(id))
+	ilst := box("ilst", box("\x00\x00\x00\x01", data))
+	meta := box("meta", box("hdlr", make([]byte, 24)), keys, ilst)
+	return append(ftyp("qt  ", "qt  "), box("moov", box("mvhd", mvhd), meta)...)
+}
+
+func TestReadMediaMetadata(t *testing.T) {
+	const id = "D2A0E7A4-4E2C-4C53-9F3A-0B6C9C0E1F11"
+	local := func(s string) time.Time {
+		ts, err := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	camera := []tiffEntry{asciiEntry(tagMake, "Apple"), asciiEntry(tagModel, "iPhone 12"), asciiEntry(tagDateTime, "2022:01:01 10:00:00")}
+	created := time.Date(2021, 6, 5, 4, 3, 2, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		file      string
+		content   []byte
+		wantTime  time.Time
+		wantMake  string
+		wantModel string
+		wantID    string
+	}{
+		{
+			name: "jpeg with offset and maker note",
+			file: "a.jpg",
+			content: buildJPEG(buildTIFF(binary.BigEndian, camera, []tiffEntry{
+				asciiEntry(tagDateTimeOriginal, "2021:07:14 18:30:00"),
+				asciiEntry(tagOffsetTimeOrig, "+02:00"),
+				{tag: tagMakerNote, typ: 7, data: appleMakerNote(id)},
+			})),
+			wantTime:  time.Date(2021, 7, 14, 16, 30, 0, 0, time.UTC),
+			wantMake:  "Apple",
+			wantModel: "iPhone 12",
+			wantID:    id,
+		},
+		{
+			name: "little-endian jpeg in local time",
+			file: "b.jpg",
+			content: buildJPEG(buildTIFF(binary.LittleEndian, camera, []tiffEntry{
+				asciiEntry(tagDateTimeOriginal, "2021:07:14 18:30:00"),
+			})),
+			wantTime:  local("2021:07:14 18:30:00"),
+			wantMake:  "Apple",
+			wantModel: "iPhone 12",
+		},
+		{
+			name: "digitized time without original",
+			file: "c.jpg",
+			content: buildJPEG(buildTIFF(binary.BigEndian, nil, []tiffEntry{
+				asciiEntry(tagDateTimeDigitized, "2020:02:29 12:00:00"),
+			})),
+			wantTime: local("2020:02:29 12:00:00"),
+		},
+		{
+			name:      "modification time without exif",
+			file:      "d.jpg",
+			content:   buildJPEG(buildTIFF(binary.BigEndian, camera, nil)),
+			wantTime:  local("2022:01:01 10:00:00"),
+			wantMake:  "Apple",
+			wantModel: "iPhone 12",
+		},
+		{
+			name: "unset camera clock",
+			file: "e.jpg",
+			content: buildJPEG(buildTIFF(binary.BigEndian, nil, []tiffEntry{
+				asciiEntry(tagDateTimeOriginal, "0000:00:00 00:00:00"),
+			})),
+		},
+		{
+			name:      "short strings stored inline",
+			file:      "f.jpg",
+			content:   buildJPEG(buildTIFF(binary.BigEndian, []tiffEntry{asciiEntry(tagMake, "LG"), asciiEntry(tagModel, "G7 ")}, nil)),
+			wantMake:  "LG",
+			wantModel: "G7",
+		},
+		{
+			name: "tiff",
+			file: "g.dng",
+			content: buildTIFF(binary.LittleEndian, camera, []tiffEntry{
+				asciiEntry(tagDateTimeOriginal, "2019:12:31 23:59:59"),
+				asciiEntry(tagOffsetTimeOrig, "-05:00"),
+			}),
+			wantTime:  time.Date(2020, 1, 1, 4, 59, 59, 0, time.UTC),
+			wantMake:  "Apple",
+			wantModel: "iPhone 12",
+		},
+		{
+			name: "heic",
+			file: "h.heic",
+			content: buildHEIC(buildTIFF(binary.BigEndian, camera, []tiffEntry{
+				asciiEntry(tagDateTimeOriginal, "2023:03:04 05:06:07"),
+				asciiEntry(tagOffsetTimeOrig, "+00:00"),
+				{tag: tagMakerNote, typ: 7, data: appleMakerNote(id)},
+			})),
+			wantTime:  time.Date(2023, 3, 4, 5, 6, 7, 0, time.UTC),
+			wantMake:  "Apple",
+			wantModel: "iPhone 12",
+			wantID:    id,
+		},
+		{
+			name:     "quicktime",
+			file:     "i.mov",
+			content:  buildMOV(created, id),
+			wantTime: created,
+			wantID:   id,
+		},
+		{
+			name:    "not media",
+			file:    "j.txt",
+			content: []byte("hello"),
+		},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			meta, err := ReadMediaMetadata(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !meta.CaptureTime.Equal(tt.wantTime) {
+				t.Errorf("CaptureTime = %v, want %v", meta.CaptureTime, tt.wantTime)
+			}
+			if meta.Make != tt.wantMake || meta.Model != tt.wantModel {
+				t.Errorf("camera = %q %q, want %q %q", meta.Make, meta.Model, tt.wantMake, tt.wantModel)
+			}
+			if meta.ContentIdentifier != tt.wantID {
+				t.Errorf("ContentIdentifier = %q, want %q", meta.ContentIdentifier, tt.wantID)
+			}
+
+			// Truncated copies must not panic or produce a time from garbage. They may
+			// lose the offset, or fall back to the modification time in IFD0 once the
+			// EXIF IFD is cut off.
+			for n := range len(tt.content) {
+				if err := os.WriteFile(path, tt.content[:n], 0644); err != nil {
+					t.Fatal(err)
+				}
+				meta, err := ReadMediaMetadata(path)
+				if err == nil && !meta.CaptureTime.IsZero() && (meta.CaptureTime.Year() < 2019 || meta.CaptureTime.Year() > 2023) {
+					t.Fatalf("truncated to %d bytes: CaptureTime = %v", n, meta.CaptureTime)
+				}
+			}
+		})
+	}
+}
+
+func TestParseExifTime(t *testing.T) {
+	tests := []struct {
+		value, offset string
+		want          time.Time
+	}{
+		{"2021:07:14 18:30:00", "+02:00", time.Date(2021, 7, 14, 16, 30, 0, 0, time.UTC)},
+		{"2021:07:14 18:30:00", "-07:00", time.Date(2021, 7, 15, 1, 30, 0, 0, time.UTC)},
+		{"2021:07:14 18:30:00.123", "+00:00", time.Date(2021, 7, 14, 18, 30, 0, 0, time.UTC)},
+		{"2021:07:14 18:30:00", "", time.Date(2021, 7, 14, 18, 30, 0, 0, time.Local)},
+		{"2021:07:14 18:30:00", "bogus!", time.Date(2021, 7, 14, 18, 30, 0, 0, time.Local)},
+		{"0000:00:00 00:00:00", "", time.Time{}},
+		{"2021:13:40 25:00:00", "", time.Time{}},
+		{"2021:07:14", "", time.Time{}},
+		{"", "", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+tt.offset, func(t *testing.T) {
+			if got := parseExifTime(tt.value, tt.offset); !got.Equal(tt.want) {
+				t.Errorf("parseExifTime(%q, %q) = %v, want %v", tt.value, tt.offset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(name, original string) string {
+		path := filepath.Join(dir, name)
+		tiff := buildTIFF(binary.BigEndian, nil, []tiffEntry{
+			asciiEntry(tagDateTimeOriginal, original),
+			asciiEntry(tagOffsetTimeOrig, "+00:00"),
+		})
+		if err := os.WriteFile(path, buildJPEG(tiff), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	taken := write("taken.jpg", "2020:05:06 07:08:09")
+	unset := write("unset.jpg", "1904:01:01 00:00:00")
+	future := write("future.jpg", time.Now().AddDate(1, 0, 0).UTC().Format("2006:01:02 15:04:05"))
+	capture := time.Date(2020, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		path   string
+		source TimestampSource
+		want   time.Time
+	}{
+		{"mtime ignores exif", taken, TimestampMtime, mtime},
+		{"default is mtime", taken, "", mtime},
+		{"exif", taken, TimestampExif, capture},
+		{"auto", taken, TimestampAuto, capture},
+		{"exif keeps an implausible time", unset, TimestampExif, time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"auto rejects an unset clock", unset, TimestampAuto, mtime},
+		{"auto rejects the future", future, TimestampAuto, mtime},
+		{"missing file", filepath.Join(dir, "missing.jpg"), TimestampExif, mtime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveTimestamp(tt.path, mtime, tt.source); !got.Equal(tt.want) {
+				t.Errorf("resolveTimestamp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
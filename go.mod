@@ -3,8 +3,13 @@ module github.com/viperadnan-git/go-gpm
 go 1.25
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/hashicorp/go-retryablehttp v0.7.8
+	golang.org/x/time v0.14.0
 	google.golang.org/protobuf v1.36.11
 )
 
-require github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+require (
+	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+)
@@ -0,0 +1,354 @@
+package gpm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/viperadnan-git/go-gpm/internal/core"
+)
+
+const (
+	hashCacheFileName    = "hashes.json"
+	hashCacheJournalName = "hashes.journal" // New entries since the last compaction, one JSON object per line
+	hashCacheLockName    = "hashes.lock"    // Held while appending to the journal or compacting it
+	hashCacheCompactAt   = 8 << 20          // Journal size at which Save folds it into the cache file
+)
+
+// HashCacheEntry is a cached SHA1 together with the file identity it was computed for
+type HashCacheEntry struct {
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mtime"` // Unix nanoseconds
+	Inode    uint64 `json:"inode,omitempty"`
+	DedupKey string `json:"sha1"` // URL-safe base64 SHA1
+}
+
+// HashCache is a persistent cache of file SHA1 hashes keyed by absolute path.
+// An entry is only used while the file's size, mtime and inode are unchanged.
+//
+// The cache is read on first use. New entries are appended to a journal as they
+// are stored, so a crash loses no work, and Save folds the journal into the cache
+// file once it has grown large. Several processes may share a cache directory.
+type HashCache struct {
+	path    string
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]HashCacheEntry
+	removed map[string]bool // Entries dropped by Prune, applied by the next Save
+	journal *os.File        // Opened on the first Store
+	lock    *os.File        // Lock file shared with other processes, opened on first need
+}
+
+// hashCacheRecord is a line of the journal
+type hashCacheRecord struct {
+	Path string `json:"path"`
+	HashCacheEntry
+}
+
+// NewHashCache returns the hash cache stored in cacheDir, which is read on first use
+// An empty cacheDir returns an in-memory cache that is never saved. A cache that
+// can't be read is logged and started empty, hashes are only a shortcut.
+func NewHashCache(cacheDir string) *HashCache {
+	c := &HashCache{entries: make(map[string]HashCacheEntry), removed: make(map[string]bool)}
+	if cacheDir == "" {
+		c.loaded = true
+		return c
+	}
+	c.path = filepath.Join(cacheDir, hashCacheFileName)
+	return c
+}
+
+func (c *HashCache) journalPath() string {
+	return filepath.Join(filepath.Dir(c.path), hashCacheJournalName)
+}
+
+// load reads the cache on first use; c.mu must be held
+func (c *HashCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	c.entries = c.readEntries()
+}
+
+// readEntries reads the cache file and applies the journal on top of it
+func (c *HashCache) readEntries() map[string]HashCacheEntry {
+	entries := make(map[string]HashCacheEntry)
+	data, err := os.ReadFile(c.path)
+	if err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to read hash cache, starting empty", "path", c.path, "error", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			slog.Warn("hash cache is corrupt, starting empty", "path", c.path, "error", err)
+			entries = make(map[string]HashCacheEntry)
+		}
+	}
+
+	// A line cut short by a crash is skipped
+	data, err = os.ReadFile(c.journalPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read hash cache journal", "path", c.journalPath(), "error", err)
+		}
+		return entries
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var record hashCacheRecord
+		if json.Unmarshal(scanner.Bytes(), &record) != nil || record.Path == "" {
+			continue
+		}
+		entries[record.Path] = record.HashCacheEntry
+	}
+	return entries
+}
+
+// locked runs fn holding the lock file shared with other processes; c.mu must be held
+func (c *HashCache) locked(fn func() error) error {
+	if c.lock == nil {
+		if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+			return fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		f, err := os.OpenFile(filepath.Join(filepath.Dir(c.path), hashCacheLockName), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open hash cache lock: %w", err)
+		}
+		c.lock = f
+	}
+	if err := lockFile(c.lock); err != nil {
+		return fmt.Errorf("failed to lock hash cache: %w", err)
+	}
+	defer unlockFile(c.lock)
+	return fn()
+}
+
+// appendJournal records an entry in the journal; c.mu must be held
+func (c *HashCache) appendJournal(record hashCacheRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return c.locked(func() error {
+		if c.journal == nil {
+			f, err := os.OpenFile(c.journalPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open hash cache journal: %w", err)
+			}
+			c.journal = f
+		}
+		if _, err := c.journal.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write hash cache journal: %w", err)
+		}
+		return nil
+	})
+}
+
+// Path returns the cache file path (empty for an in-memory cache)
+func (c *HashCache) Path() string {
+	return c.path
+}
+
+// Len returns the number of cached entries
+func (c *HashCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+	return len(c.entries)
+}
+
+// Entries returns a copy of all cached entries keyed by absolute path
+func (c *HashCache) Entries() map[string]HashCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+	return maps.Clone(c.entries)
+}
+
+// Lookup returns the cached SHA1 for path if the file has not changed since it was hashed
+func (c *HashCache) Lookup(path string, info os.FileInfo) ([]byte, bool) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	c.load()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || !entry.matches(info) {
+		return nil, false
+	}
+
+	hash, err := core.DedupeKeyToSHA1(entry.DedupKey)
+	if err != nil {
+		return nil, false
+	}
+	return hash, true
+}
+
+// Store records the SHA1 for path, replacing any stale entry
+func (c *HashCache) Store(path string, info os.FileInfo, sha1Hash []byte) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	entry := HashCacheEntry{
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		Inode:    fileInode(info),
+		DedupKey: core.SHA1ToDedupeKey(sha1Hash),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+	c.entries[key] = entry
+	delete(c.removed, key)
+	if c.path == "" {
+		return
+	}
+	if err := c.appendJournal(hashCacheRecord{Path: key, HashCacheEntry: entry}); err != nil {
+		slog.Warn("failed to record hash", "path", key, "error", err)
+	}
+}
+
+// Prune removes entries whose file no longer exists or has changed
+// Returns the number of removed entries, which are dropped from disk by Save.
+func (c *HashCache) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+
+	removed := 0
+	for path, entry := range c.entries {
+		info, err := os.Stat(path)
+		if err != nil || !entry.matches(info) {
+			delete(c.entries, path)
+			c.removed[path] = true
+			removed++
+		}
+	}
+	return removed
+}
+
+// Clear removes all entries and deletes the cache file
+func (c *HashCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loaded = true
+	c.entries = make(map[string]HashCacheEntry)
+	clear(c.removed)
+	if c.path == "" {
+		return nil
+	}
+	return c.locked(func() error {
+		if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove hash cache: %w", err)
+		}
+		if err := os.Truncate(c.journalPath(), 0); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear hash cache journal: %w", err)
+		}
+		return nil
+	})
+}
+
+// Save folds the journal into the cache file once it has passed hashCacheCompactAt,
+// or whenever Prune has removed entries. Entries stored since by other processes
+// are kept.
+func (c *HashCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path == "" {
+		return nil
+	}
+	if len(c.removed) == 0 {
+		info, err := os.Stat(c.journalPath())
+		if err != nil || info.Size() < hashCacheCompactAt {
+			return nil
+		}
+	}
+	return c.locked(c.compact)
+}
+
+// compact rewrites the cache file from disk, which has every process's entries,
+// and empties the journal; c.mu and the lock file must be held. The journal is
+// truncated rather than removed, so processes holding it open keep appending to
+// the file that is read.
+func (c *HashCache) compact() error {
+	entries := c.readEntries()
+	for path := range c.removed {
+		delete(entries, path)
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hash cache: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	if err := os.Truncate(c.journalPath(), 0); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to truncate hash cache journal: %w", err)
+	}
+	c.loaded = true
+	c.entries = entries
+	clear(c.removed)
+	return nil
+}
+
+// matches reports whether the entry still describes the file
+func (e HashCacheEntry) matches(info os.FileInfo) bool {
+	if e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return false
+	}
+	// Inode is 0 on platforms that don't expose it
+	return e.Inode == fileInode(info)
+}
+
+// HashFile returns the SHA1 of a file, consulting the hash cache before reading it
+func (g *GooglePhotosAPI) HashFile(ctx context.Context, filePath string) ([]byte, error) {
+	return g.hashFile(ctx, filePath, nil, nil)
+}
+
+// hashFile is HashFile with progress reporting for files that are not cached
+// Reads go through run, which may be nil.
+func (g *GooglePhotosAPI) hashFile(ctx context.Context, filePath string, run *uploadRun, progress ProgressFunc) ([]byte, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing file: %w", err)
+	}
+	if hash, ok := g.hashCache.Lookup(filePath, info); ok {
+		return hash, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+	hash, err := hashReader(ctx, io.NewSectionReader(run.readerAt(ctx, file), 0, info.Size()), info.Size(), progress)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil || !run.dryRun {
+		g.hashCache.Store(filePath, info, hash)
+	}
+	return hash, nil
+}
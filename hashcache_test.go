@@ -0,0 +1,145 @@
+package gpm
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeHashFile creates a file in dir and returns its path, stat and SHA1
+func writeHashFile(t *testing.T, dir, name string) (string, os.FileInfo, []byte) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha1.Sum([]byte(name))
+	return path, info, hash[:]
+}
+
+func TestHashCacheJournal(t *testing.T) {
+	file, info, hash := writeHashFile(t, t.TempDir(), "photo.jpg")
+
+	tests := []struct {
+		name    string
+		save    bool   // Save before reopening, else the process "crashed"
+		extra   string // Appended to the journal before reopening
+		compact bool   // The journal is past the compaction threshold
+	}{
+		{"saved", true, "", false},
+		{"crashed", false, "", false},
+		{"crashed mid-line", false, `{"path":"/other.jpg","si`, false},
+		{"saved past the threshold", true, string(bytes.Repeat([]byte("\n"), hashCacheCompactAt)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := filepath.Join(t.TempDir(), "cache")
+			c := NewHashCache(cacheDir)
+			c.Store(file, info, hash)
+			journal := filepath.Join(cacheDir, hashCacheJournalName)
+			if tt.extra != "" {
+				f, err := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.WriteString(tt.extra)
+				f.Close()
+			}
+			if tt.save {
+				if err := c.Save(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			jinfo, err := os.Stat(journal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compacted := jinfo.Size() == 0; compacted != tt.compact {
+				t.Errorf("journal is %d bytes, compacted = %v, want %v", jinfo.Size(), compacted, tt.compact)
+			}
+			if _, err := os.Stat(filepath.Join(cacheDir, hashCacheFileName)); (err == nil) != tt.compact {
+				t.Errorf("cache file written = %v, want %v", err == nil, tt.compact)
+			}
+
+			reopened := NewHashCache(cacheDir)
+			got, ok := reopened.Lookup(file, info)
+			if !ok || !bytes.Equal(got, hash) {
+				t.Errorf("Lookup() = %x, %v, want %x", got, ok, hash)
+			}
+			if n := reopened.Len(); n != 1 {
+				t.Errorf("Len() = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestHashCacheLazyLoad(t *testing.T) {
+	cacheDir := t.TempDir()
+	file, info, hash := writeHashFile(t, t.TempDir(), "photo.jpg")
+
+	// Nothing is read until the first lookup, so entries stored in between are seen
+	c := NewHashCache(cacheDir)
+	NewHashCache(cacheDir).Store(file, info, hash)
+	if _, ok := c.Lookup(file, info); !ok {
+		t.Error("entry stored before the first lookup not found")
+	}
+}
+
+func TestHashCacheCompactKeepsOtherProcesses(t *testing.T) {
+	cacheDir := t.TempDir()
+	files := t.TempDir()
+	kept, keptInfo, keptHash := writeHashFile(t, files, "kept.jpg")
+	gone, goneInfo, goneHash := writeHashFile(t, files, "gone.jpg")
+	other, otherInfo, otherHash := writeHashFile(t, files, "other.jpg")
+
+	c := NewHashCache(cacheDir)
+	c.Store(kept, keptInfo, keptHash)
+	c.Store(gone, goneInfo, goneHash)
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Prune(); n != 1 {
+		t.Fatalf("Prune() = %d, want 1", n)
+	}
+
+	// Another process appends while this one holds the cache open
+	NewHashCache(cacheDir).Store(other, otherInfo, otherHash)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewHashCache(cacheDir)
+	entries := reopened.Entries()
+	if len(entries) != 2 {
+		t.Errorf("Entries() = %v, want kept.jpg and other.jpg", entries)
+	}
+	for _, f := range []struct {
+		path string
+		info os.FileInfo
+	}{{kept, keptInfo}, {other, otherInfo}} {
+		if _, ok := reopened.Lookup(f.path, f.info); !ok {
+			t.Errorf("%s missing after compaction", filepath.Base(f.path))
+		}
+	}
+	if _, ok := entries[gone]; ok {
+		t.Error("pruned entry came back after compaction")
+	}
+}
+
+func TestNewHashCacheUnreadable(t *testing.T) {
+	cacheDir := t.TempDir()
+	// A directory where the cache file should be can't be read as one
+	if err := os.Mkdir(filepath.Join(cacheDir, hashCacheFileName), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if n := NewHashCache(cacheDir).Len(); n != 0 {
+		t.Errorf("Len() = %d, want 0", n)
+	}
+}
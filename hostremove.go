@@ -0,0 +1,207 @@
+package gpm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// removesFromHost reports whether local files are deleted or moved after upload
+func (o UploadOptions) removesFromHost() bool {
+	return o.DeleteFromHost || o.MoveTo != ""
+}
+
+// removeFromHost deletes the item's local file, or moves it to opts.MoveTo, once the
+// library is confirmed to hold it. Anything that doesn't check out leaves the file in
+// place and is reported as StatusKept.
+func (g *GooglePhotosAPI) removeFromHost(ctx context.Context, item uploadItem, mediaKey string, workerID int, opts UploadOptions, events chan<- UploadEvent) {
+	send := func(status UploadStatus, movedTo string, err error) {
+		events <- UploadEvent{
+			Path: item.source, Status: status, MediaType: item.mediaType, MediaKey: mediaKey, DedupKey: item.dedupKey,
+			Error: err, WorkerID: workerID, MovedTo: movedTo,
+		}
+	}
+
+	send(StatusVerifying, "", nil)
+	if err := g.verifyRemote(ctx, item, mediaKey, opts.VerifyDownload); err != nil {
+		send(StatusKept, "", fmt.Errorf("verification failed: %w", err))
+		return
+	}
+	if err := checkUnchanged(ctx, item); err != nil {
+		send(StatusKept, "", err)
+		return
+	}
+
+	if opts.MoveTo != "" {
+		dest, err := moveToDir(item.path, item.root, opts.MoveTo)
+		if err != nil {
+			send(StatusKept, "", fmt.Errorf("move error: %w", err))
+			return
+		}
+		send(StatusMoved, dest, nil)
+		return
+	}
+	if err := os.Remove(item.path); err != nil {
+		send(StatusKept, "", fmt.Errorf("delete error: %w", err))
+		return
+	}
+	send(StatusDeleted, "", nil)
+}
+
+// verifyRemote looks the item's hash up in the library again and, if download is set,
+// downloads mediaKey and compares its SHA1 with the local one. Downloads only match
+// for unedited items stored in original quality.
+func (g *GooglePhotosAPI) verifyRemote(ctx context.Context, item uploadItem, mediaKey string, download bool) error {
+	found, err := g.FindRemoteMediaByHashes(ctx, [][]byte{item.sha1Hash})
+	if err != nil {
+		return fmt.Errorf("hash lookup failed: %w", err)
+	}
+	if found[item.dedupKey] == "" {
+		return errors.New("hash not found in library")
+	}
+	if !download {
+		return nil
+	}
+
+	downloadURL, _, err := g.GetDownloadUrl(mediaKey)
+	if err != nil {
+		return fmt.Errorf("failed to get download url: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+
+	hash := sha1.New()
+	cw := &chunkedContextWriter{ctx: ctx, w: hash}
+	if _, err := io.CopyBuffer(cw, resp.Body, make([]byte, copyBufferSize)); err != nil {
+		return fmt.Errorf("download error: %w", err)
+	}
+	if !bytes.Equal(hash.Sum(nil), item.sha1Hash) {
+		return errors.New("downloaded copy does not match local file")
+	}
+	return nil
+}
+
+// checkUnchanged makes sure the file wasn't modified after it was hashed. The file is
+// read again rather than trusting the hash cache, whose entries only compare size,
+// mtime and inode and can't tell a rewritten file apart from the one that was uploaded.
+func checkUnchanged(ctx context.Context, item uploadItem) error {
+	if item.info != nil {
+		info, err := os.Stat(item.path)
+		if err != nil {
+			return fmt.Errorf("stat error: %w", err)
+		}
+		if info.Size() != item.info.Size() || !info.ModTime().Equal(item.info.ModTime()) {
+			return errors.New("file changed since it was hashed")
+		}
+	}
+
+	file, err := os.Open(item.path)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+	hash, err := hashReader(ctx, file, 0, nil)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash, item.sha1Hash) {
+		return errors.New("file content does not match the uploaded hash")
+	}
+	return nil
+}
+
+// moveToDir moves path into dir, keeping its location relative to root, and returns
+// the new path. Existing files are never overwritten, a numeric suffix is added instead.
+// Moves across filesystems fall back to copying.
+func moveToDir(path, root, dir string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if root == "" || err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	dest := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Reserve the destination name so concurrent moves can't pick the same one
+	placeholder, dest, err := createUnique(dest)
+	if err != nil {
+		return "", err
+	}
+	placeholder.Close()
+
+	if err := os.Rename(path, dest); err == nil {
+		return dest, nil
+	}
+	if err := copyFile(path, dest); err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return dest, fmt.Errorf("copied to %s but failed to remove original: %w", dest, err)
+	}
+	return dest, nil
+}
+
+// createUnique creates a new empty file at path, or at "name (n).ext" if path exists
+func createUnique(path string) (*os.File, string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return f, path, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, "", fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		path = base + " (" + strconv.Itoa(n) + ")" + ext
+	}
+}
+
+// copyFile copies src over dst, syncing it to disk and keeping the modification time
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("stat error: %w", err)
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dst, err)
+	}
+	_, err = io.CopyBuffer(out, in, make([]byte, copyBufferSize))
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("copy error: %w", err)
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
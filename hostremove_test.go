@@ -0,0 +1,74 @@
+package gpm
+
+import (
+	"context"
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckUnchanged(t *testing.T) {
+	ctx := context.Background()
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		rewrite []byte // Written over the file after hashing, keeping size and mtime
+		wantErr bool
+	}{
+		{name: "unchanged"},
+		{name: "stale cache entry", rewrite: []byte("edited!"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "photo.jpg")
+			original := []byte("pixels!")
+			if err := os.WriteFile(path, original, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+
+			g := &GooglePhotosAPI{hashCache: &HashCache{entries: make(map[string]HashCacheEntry)}}
+			hash, err := g.HashFile(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.rewrite != nil {
+				f, err := os.OpenFile(path, os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteAt(tt.rewrite, 0); err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The cache can't tell the rewrite apart and still returns the old hash
+			cached, err := g.HashFile(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := sha1.Sum(original); string(cached) != string(want[:]) {
+				t.Fatalf("cache returned %x, want the stale %x", cached, want)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			item := uploadItem{path: path, sha1Hash: hash, info: info}
+			if err := checkUnchanged(ctx, item); (err != nil) != tt.wantErr {
+				t.Errorf("checkUnchanged() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package gpm
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// IgnoreFileName is the per-directory file listing gitignore-style patterns to skip
+const IgnoreFileName = ".gpcliignore"
+
+// ignoreRule is a single compiled gitignore-style pattern
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool // "!pattern" re-includes a previously excluded path
+	dirOnly bool // "pattern/" only matches directories
+}
+
+// compileIgnorePattern converts a gitignore-style pattern to a rule
+// Patterns without a slash match a name at any depth, others are anchored to the
+// directory they are relative to. Supports *, ?, [...], ** and escaping with \
+func compileIgnorePattern(pattern string) (ignoreRule, error) {
+	var rule ignoreRule
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return rule, fmt.Errorf("empty pattern")
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				if i+2 < len(pattern) && pattern[i+2] == '/' {
+					// "**/" matches zero or more directories
+					re.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					re.WriteString(".*")
+					i++
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return rule, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	rule.re = compiled
+	return rule, nil
+}
+
+func compileIgnorePatterns(patterns []string) ([]ignoreRule, error) {
+	rules := make([]ignoreRule, 0, len(patterns))
+	for _, p := range patterns {
+		rule, err := compileIgnorePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// readIgnoreFile parses a .gpcliignore file, skipping blank lines and # comments
+func readIgnoreFile(path string) ([]ignoreRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := compileIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// matchRules applies rules in order to a slash-separated relative path
+// Returns whether the last matching rule excludes it and whether any rule matched
+func matchRules(rules []ignoreRule, rel string, isDir bool) (excluded, matched bool) {
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			excluded, matched = !r.negate, true
+		}
+	}
+	return excluded, matched
+}
+
+// pathFilter decides which files under an upload root are uploaded, combining the
+// media type filter, include/exclude patterns and .gpcliignore files
+type pathFilter struct {
+	include       []ignoreRule
+	exclude       []ignoreRule
+	disableFilter bool
+
+	mu       sync.Mutex
+	dirRules map[string][]ignoreRule // Parsed .gpcliignore per directory
+}
+
+func newPathFilter(opts UploadOptions) (*pathFilter, error) {
+	include, err := compileIgnorePatterns(opts.Include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	exclude, err := compileIgnorePatterns(opts.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	return &pathFilter{
+		include:       include,
+		exclude:       exclude,
+		disableFilter: opts.DisableFilter,
+		dirRules:      make(map[string][]ignoreRule),
+	}, nil
+}
+
+// rulesFor returns the cached .gpcliignore rules of dir
+func (f *pathFilter) rulesFor(dir string) []ignoreRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if rules, ok := f.dirRules[dir]; ok {
+		return rules
+	}
+	rules, err := readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to read ignore file", "dir", dir, "error", err)
+	}
+	f.dirRules[dir] = rules
+	return rules
+}
+
+// excluded reports whether a single entry under root is excluded. Patterns given in
+// options are relative to root, .gpcliignore patterns to their own directory, and
+// deeper files take precedence. Parent directories are not checked.
+func (f *pathFilter) excluded(root, path string, isDir bool) bool {
+	if filepath.Base(path) == IgnoreFileName {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	excluded, _ := matchRules(f.exclude, filepath.ToSlash(rel), isDir)
+
+	// Walk from root down to the entry's parent, applying each directory's ignore file
+	dir := root
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		sub := strings.Join(parts[i:], "/")
+		if ex, ok := matchRules(f.rulesFor(dir), sub, isDir); ok {
+			excluded = ex
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return excluded
+}
+
+// excludedWithParents is like excluded but also checks every directory between root and path
+func (f *pathFilter) excludedWithParents(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	dir := root
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		if f.excluded(root, dir, true) {
+			return true
+		}
+	}
+	return f.excluded(root, path, false)
+}
+
+// wanted reports whether a file is supported media and matches the include patterns
+func (f *pathFilter) wanted(root, path string) bool {
+	return f.unwanted(root, path) == ""
+}
+
+// unwanted returns why wanted rejects a file, or "" if it doesn't
+func (f *pathFilter) unwanted(root, path string) string {
+	_, reason := f.check(root, path)
+	return reason
+}
+
+// check is unwanted that also returns the media type it detected, "" when the
+// media type filter is disabled
+func (f *pathFilter) check(root, path string) (mediaType, reason string) {
+	if !f.disableFilter {
+		var ok bool
+		if mediaType, ok = resolveMediaType(path); !ok {
+			return "", "unsupported file type"
+		}
+	}
+	return mediaType, f.unincluded(root, path)
+}
+
+// unincluded returns why the include patterns reject a file, or "" if they don't
+func (f *pathFilter) unincluded(root, path string) string {
+	if len(f.include) == 0 {
+		return ""
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	if included, _ := matchRules(f.include, filepath.ToSlash(rel), false); !included {
+		return "not matched by include patterns"
+	}
+	return ""
+}
+
+// accepts runs the full check for a single file found under root
+func (f *pathFilter) accepts(root, path string) bool {
+	return f.wanted(root, path) && !f.excludedWithParents(root, path)
+}
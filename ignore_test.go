@@ -0,0 +1,152 @@
+package gpm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Names without a slash match at any depth
+		{"*.tmp", "a.tmp", false, true},
+		{"*.tmp", "x/y/a.tmp", false, true},
+		{"*.tmp", "a.tmp.jpg", false, false},
+		{"Thumbs.db", "photos/Thumbs.db", false, true},
+
+		// A slash anchors the pattern to its directory
+		{"/cache", "cache", true, true},
+		{"/cache", "sub/cache", true, false},
+		{"raw/*.dng", "raw/a.dng", false, true},
+		{"raw/*.dng", "x/raw/a.dng", false, false},
+		{"raw/*.dng", "raw/sub/a.dng", false, false},
+
+		// ** spans directories
+		{"**/edits", "edits", true, true},
+		{"**/edits", "a/b/edits", true, true},
+		{"trips/**", "trips/2020/a.jpg", false, true},
+		{"trips/**", "other/a.jpg", false, false},
+		{"a/**/b.jpg", "a/b.jpg", false, true},
+		{"a/**/b.jpg", "a/x/y/b.jpg", false, true},
+		{"**.jpg", "deep/dir/a.jpg", false, true},
+
+		// Single-character wildcards and classes
+		{"IMG_????.JPG", "IMG_0001.JPG", false, true},
+		{"IMG_????.JPG", "IMG_01.JPG", false, false},
+		{"?.jpg", "a/b.jpg", false, true},
+		{"[ab].jpg", "a.jpg", false, true},
+		{"[ab].jpg", "c.jpg", false, false},
+		{"[!ab].jpg", "c.jpg", false, true},
+		{"[!ab].jpg", "a.jpg", false, false},
+		{"[unclosed", "[unclosed", false, true},
+
+		// Escapes and regexp metacharacters are literal
+		{`\!important.jpg`, "!important.jpg", false, true},
+		{`\*.jpg`, "*.jpg", false, true},
+		{`\*.jpg`, "a.jpg", false, false},
+		{"a+b (1).jpg", "a+b (1).jpg", false, true},
+
+		// A trailing slash only matches directories
+		{"backup/", "backup", true, true},
+		{"backup/", "backup", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			rule, err := compileIgnorePattern(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := matchRules([]ignoreRule{rule}, tt.path, tt.isDir)
+			if got != tt.want {
+				t.Errorf("pattern %q on %q (dir %v) = %v, want %v (regexp %s)", tt.pattern, tt.path, tt.isDir, got, tt.want, rule.re)
+			}
+		})
+	}
+}
+
+func TestCompileIgnorePatternErrors(t *testing.T) {
+	for _, pattern := range []string{"", "!", "/", "!/"} {
+		if _, err := compileIgnorePattern(pattern); err == nil {
+			t.Errorf("compileIgnorePattern(%q) succeeded, want an error", pattern)
+		}
+	}
+}
+
+func TestMatchRulesNegation(t *testing.T) {
+	tests := []struct {
+		name         string
+		patterns     []string
+		path         string
+		isDir        bool
+		wantExcluded bool
+		wantMatched  bool
+	}{
+		{"no rules", nil, "a.jpg", false, false, false},
+		{"excluded", []string{"*.jpg"}, "a.jpg", false, true, true},
+		{"re-included", []string{"*.jpg", "!keep.jpg"}, "keep.jpg", false, false, true},
+		{"re-include only affects its match", []string{"*.jpg", "!keep.jpg"}, "drop.jpg", false, true, true},
+		{"last match wins", []string{"!keep.jpg", "*.jpg"}, "keep.jpg", false, true, true},
+		{"negated directory", []string{"*", "!albums/"}, "albums", true, false, true},
+		{"directory-only rule skips files", []string{"*.jpg", "!*.jpg/"}, "a.jpg", false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileIgnorePatterns(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			excluded, matched := matchRules(rules, tt.path, tt.isDir)
+			if excluded != tt.wantExcluded || matched != tt.wantMatched {
+				t.Errorf("matchRules(%q) = %v, %v, want %v, %v", tt.path, excluded, matched, tt.wantExcluded, tt.wantMatched)
+			}
+		})
+	}
+}
+
+func TestPathFilterIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(IgnoreFileName, "# comment\n\n*.tmp\nprivate/\n")
+	write("trip/"+IgnoreFileName, "!keep.tmp\n/local.jpg\n")
+
+	filter, err := newPathFilter(UploadOptions{Exclude: []string{"**/cache/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a.jpg", false},
+		{"a.tmp", true},
+		{"trip/b.tmp", true},
+		{"trip/keep.tmp", false},
+		{"trip/local.jpg", true},
+		{"trip/sub/local.jpg", false},
+		{"private/a.jpg", true},
+		{"trip/private/a.jpg", true},
+		{"x/cache/a.jpg", true},
+		{IgnoreFileName, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join(root, filepath.FromSlash(tt.path))
+			if got := filter.excludedWithParents(root, path); got != tt.want {
+				t.Errorf("excludedWithParents(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package gpm
+
+import "os"
+
+// fileInode returns 0 on platforms without inode numbers
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
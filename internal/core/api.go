@@ -85,6 +85,15 @@ type ApiConfig struct {
 	Proxy    string // Proxy URL
 	Quality  string // Default quality: "original" or "storage-saver"
 	UseQuota bool   // If true, uploaded files count against storage quota (default: false)
+	CacheDir string // Directory for persistent client state: resumable uploads, file hashes (empty disables)
+
+	// BandwidthLimit caps transfer rates for all requests of this client, see
+	// ParseBandwidthSchedule for the format (empty means unlimited)
+	BandwidthLimit string
+
+	// UploadWorkers caps the files transferred at once across all uploads running on
+	// this client, shared fairly between them (0 means each upload only has its own limit)
+	UploadWorkers int
 }
 
 // Api represents a Google Photos API client
@@ -115,9 +124,9 @@ func NewApi(cfg ApiConfig) (*Api, error) {
 		language = params.Get("lang")
 	}
 
-	client, err := NewHTTPClientWithProxy(cfg.Proxy)
+	schedule, err := ParseBandwidthSchedule(cfg.BandwidthLimit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+		return nil, fmt.Errorf("invalid bandwidth limit: %w", err)
 	}
 
 	api := &Api{
@@ -127,7 +136,6 @@ func NewApi(cfg ApiConfig) (*Api, error) {
 		ClientVersionCode: 49029607,
 		Language:          language,
 		AuthData:          strings.TrimSpace(cfg.AuthData),
-		Client:            client,
 		authTokenCache: map[string]string{
 			"Expiry": "0",
 			"Auth":   "",
@@ -136,6 +144,11 @@ func NewApi(cfg ApiConfig) (*Api, error) {
 		UseQuota: cfg.UseQuota,
 	}
 
+	api.Client, err = newHTTPClient(cfg.Proxy, newBandwidthLimiter(schedule))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+
 	api.UserAgent = fmt.Sprintf(
 		"com.google.android.apps.photos/%d (Linux; U; Android 9; %s; %s; Build/PQ2A.190205.001; Cronet/127.0.6510.5) (gzip)",
 		api.ClientVersionCode,
@@ -280,13 +293,12 @@ func (a *Api) SetModel(model string) {
 }
 
 // checkResponse checks if the HTTP response status is successful (2xx).
-// Returns an error with the response body if status is not 2xx.
+// Returns a *StatusError with the response body if status is not 2xx.
 func checkResponse(resp *http.Response) error {
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return nil
 	}
-	body, _ := io.ReadAll(resp.Body)
-	return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	return newStatusError(resp)
 }
 
 // readGzipBody reads the response body, handling gzip decompression if needed.
@@ -400,7 +412,7 @@ func (a *Api) DoProtoRequest(url string, reqMsg proto.Message, respMsg proto.Mes
 
 	if respMsg != nil {
 		if err := proto.Unmarshal(bodyBytes, respMsg); err != nil {
-			return fmt.Errorf("failed to unmarshal protobuf: %w", err)
+			return &RejectedError{Msg: "failed to unmarshal protobuf", Err: err}
 		}
 	}
 
@@ -0,0 +1,247 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// bandwidthBurst is the largest read or write passed through a limiter at once
+const bandwidthBurst = 64 * 1024
+
+// BandwidthRate is a pair of transfer limits in bytes per second (0 means unlimited)
+type BandwidthRate struct {
+	Upload   int64
+	Download int64
+}
+
+// bandwidthSlot is a rate that applies from a time of day until the next slot starts
+type bandwidthSlot struct {
+	start time.Duration // Offset from midnight
+	rate  BandwidthRate
+}
+
+// BandwidthSchedule is a parsed bandwidth limit, either constant or by time of day
+type BandwidthSchedule []bandwidthSlot
+
+// ParseBandwidthSchedule parses a bandwidth limit in one of these forms:
+//
+//	2M                   2 MiB/s for both directions
+//	512K:10M             512 KiB/s upload, 10 MiB/s download
+//	08:00,2M 19:00,off   2 MiB/s from 08:00, unlimited from 19:00 until 08:00
+//
+// Sizes take a B, K, M or G suffix (powers of 1024); a bare number is KiB.
+// An empty string or "off" means unlimited and returns a nil schedule.
+func ParseBandwidthSchedule(s string) (BandwidthSchedule, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	if len(fields) == 1 && !strings.Contains(fields[0], ",") {
+		rate, err := parseBandwidthRate(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if rate == (BandwidthRate{}) {
+			return nil, nil
+		}
+		return BandwidthSchedule{{rate: rate}}, nil
+	}
+
+	schedule := make(BandwidthSchedule, 0, len(fields))
+	for _, field := range fields {
+		at, rateStr, ok := strings.Cut(field, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid bandwidth schedule entry %q (want HH:MM,RATE)", field)
+		}
+		clock, err := time.Parse("15:04", at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q in bandwidth schedule", at)
+		}
+		rate, err := parseBandwidthRate(rateStr)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+		schedule = append(schedule, bandwidthSlot{start: start, rate: rate})
+	}
+	sort.SliceStable(schedule, func(i, j int) bool { return schedule[i].start < schedule[j].start })
+	return schedule, nil
+}
+
+// parseBandwidthRate parses "RATE" or "UPLOAD:DOWNLOAD"
+func parseBandwidthRate(s string) (BandwidthRate, error) {
+	up, down, split := strings.Cut(s, ":")
+	upload, err := parseBandwidthSize(up)
+	if err != nil {
+		return BandwidthRate{}, err
+	}
+	download := upload
+	if split {
+		if download, err = parseBandwidthSize(down); err != nil {
+			return BandwidthRate{}, err
+		}
+	}
+	return BandwidthRate{Upload: upload, Download: download}, nil
+}
+
+// parseBandwidthSize parses a size like "512K", "2M" or "off" into bytes per second
+func parseBandwidthSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "off") || s == "0" {
+		return 0, nil
+	}
+
+	multiplier := float64(1024) // Bare numbers are KiB
+	if i := len(s) - 1; s[i] < '0' || s[i] > '9' {
+		switch s[i] {
+		case 'B', 'b':
+			multiplier = 1
+		case 'K', 'k':
+		case 'M', 'm':
+			multiplier = 1024 * 1024
+		case 'G', 'g':
+			multiplier = 1024 * 1024 * 1024
+		default:
+			return 0, fmt.Errorf("invalid bandwidth unit in %q (use B, K, M or G)", s)
+		}
+		s = s[:i]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q", s)
+	}
+	return int64(value * multiplier), nil
+}
+
+// At returns the rate in effect at the given time of day
+// Before the first slot of the day, the last slot of the previous day still applies
+func (s BandwidthSchedule) At(t time.Time) BandwidthRate {
+	if len(s) == 0 {
+		return BandwidthRate{}
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	current := s[len(s)-1]
+	for _, slot := range s {
+		if slot.start > offset {
+			break
+		}
+		current = slot
+	}
+	return current.rate
+}
+
+// bandwidthLimiter holds the token buckets shared by every connection of an Api
+type bandwidthLimiter struct {
+	schedule BandwidthSchedule
+	upload   *rate.Limiter
+	download *rate.Limiter
+
+	mu      sync.Mutex
+	current BandwidthRate
+}
+
+func newBandwidthLimiter(schedule BandwidthSchedule) *bandwidthLimiter {
+	if len(schedule) == 0 {
+		return nil
+	}
+	current := schedule.At(time.Now())
+	return &bandwidthLimiter{
+		schedule: schedule,
+		upload:   rate.NewLimiter(bytesPerSecond(current.Upload), bandwidthBurst),
+		download: rate.NewLimiter(bytesPerSecond(current.Download), bandwidthBurst),
+		current:  current,
+	}
+}
+
+// refresh applies the scheduled rate if it changed since the last call
+func (l *bandwidthLimiter) refresh() {
+	r := l.schedule.At(time.Now())
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r == l.current {
+		return
+	}
+	l.current = r
+	l.upload.SetLimit(bytesPerSecond(r.Upload))
+	l.download.SetLimit(bytesPerSecond(r.Download))
+}
+
+func bytesPerSecond(n int64) rate.Limit {
+	if n <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(n)
+}
+
+// wait blocks until n bytes may pass through the given bucket or ctx is done
+func (l *bandwidthLimiter) wait(ctx context.Context, bucket *rate.Limiter, n int) error {
+	l.refresh()
+	return bucket.WaitN(ctx, n)
+}
+
+// dialContext wraps dial so every connection it opens is throttled
+func (l *bandwidthLimiter) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		closed, cancel := context.WithCancel(context.Background())
+		return &throttledConn{Conn: conn, limiter: l, closed: closed, cancel: cancel}, nil
+	}
+}
+
+// throttledConn limits a connection at the socket, so every request and response of
+// the Api counts whatever produced it: writes count as upload, reads as download.
+// Closing the connection, which the transport does when a request is cancelled,
+// releases reads and writes waiting for the limiter.
+type throttledConn struct {
+	net.Conn
+	limiter *bandwidthLimiter
+	closed  context.Context
+	cancel  context.CancelFunc
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if len(p) > bandwidthBurst {
+		p = p[:bandwidthBurst]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if waitErr := c.limiter.wait(c.closed, c.limiter.download, n); waitErr != nil && err == nil {
+			err = net.ErrClosed
+		}
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:min(written+bandwidthBurst, len(p))]
+		if err := c.limiter.wait(c.closed, c.limiter.upload, len(chunk)); err != nil {
+			return written, net.ErrClosed
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (c *throttledConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidthSchedule(t *testing.T) {
+	const (
+		k = 1024
+		m = 1024 * 1024
+	)
+	hm := func(h, min int) time.Duration { return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute }
+
+	tests := []struct {
+		in      string
+		want    BandwidthSchedule
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "off", want: nil},
+		{in: "0", want: nil},
+		{in: "0:0", want: nil},
+		{in: "2M", want: BandwidthSchedule{{rate: BandwidthRate{2 * m, 2 * m}}}},
+		{in: "512", want: BandwidthSchedule{{rate: BandwidthRate{512 * k, 512 * k}}}},
+		{in: "100B", want: BandwidthSchedule{{rate: BandwidthRate{100, 100}}}},
+		{in: "1.5k", want: BandwidthSchedule{{rate: BandwidthRate{1536, 1536}}}},
+		{in: "1G", want: BandwidthSchedule{{rate: BandwidthRate{1024 * m, 1024 * m}}}},
+		{in: "512K:10M", want: BandwidthSchedule{{rate: BandwidthRate{512 * k, 10 * m}}}},
+		{in: "off:1M", want: BandwidthSchedule{{rate: BandwidthRate{0, m}}}},
+		{
+			in: "19:00,off 08:00,2M",
+			want: BandwidthSchedule{
+				{start: hm(8, 0), rate: BandwidthRate{2 * m, 2 * m}},
+				{start: hm(19, 0), rate: BandwidthRate{}},
+			},
+		},
+		{
+			in: "  08:30,1M:4M\t22:15,256K ",
+			want: BandwidthSchedule{
+				{start: hm(8, 30), rate: BandwidthRate{m, 4 * m}},
+				{start: hm(22, 15), rate: BandwidthRate{256 * k, 256 * k}},
+			},
+		},
+		{in: "2X", wantErr: true},
+		{in: "-1M", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "1M:fast", wantErr: true},
+		{in: "08:00,1M 09:00", wantErr: true},
+		{in: "25:00,1M", wantErr: true},
+		{in: "8h,1M", wantErr: true},
+		{in: "08:00,1M 2M", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBandwidthSchedule(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBandwidthSchedule(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseBandwidthSchedule(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("slot %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBandwidthScheduleAt(t *testing.T) {
+	day := BandwidthRate{Upload: 1, Download: 1}
+	evening := BandwidthRate{Upload: 2, Download: 2}
+	night := BandwidthRate{} // Unlimited
+
+	// 08:00 to 19:00 limited, 19:00 to 23:30 less so, unlimited from 23:30 across midnight
+	schedule, err := ParseBandwidthSchedule("08:00,1B 19:00,2B 23:30,off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	constant, err := ParseBandwidthSchedule("1B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(h, m, s int) time.Time { return time.Date(2024, 3, 10, h, m, s, 0, time.Local) }
+
+	tests := []struct {
+		name     string
+		schedule BandwidthSchedule
+		at       time.Time
+		want     BandwidthRate
+	}{
+		{"first slot starts", schedule, at(8, 0, 0), day},
+		{"during the day", schedule, at(12, 30, 0), day},
+		{"second before the evening", schedule, at(18, 59, 59), day},
+		{"evening", schedule, at(19, 0, 0), evening},
+		{"late night", schedule, at(23, 45, 0), night},
+		{"midnight carries over", schedule, at(0, 0, 0), night},
+		{"early morning carries over", schedule, at(7, 59, 59), night},
+		{"constant", constant, at(3, 0, 0), day},
+		{"unlimited", nil, at(3, 0, 0), BandwidthRate{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.At(tt.at); got != tt.want {
+				t.Errorf("At(%s) = %+v, want %+v", tt.at.Format("15:04:05"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottledConnCloseReleasesWrites(t *testing.T) {
+	limiter := newBandwidthLimiter(BandwidthSchedule{{rate: BandwidthRate{Upload: 1, Download: 1}}})
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+
+	dial := limiter.dialContext(func(ctx context.Context, network, addr string) (net.Conn, error) { return client, nil })
+	conn, err := dial(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		// The first burst passes, the second would wait for most of a day at 1 B/s
+		_, err := conn.Write(make([]byte, 2*bandwidthBurst))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Write() error = %v, want net.ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write() still waiting for the limiter after Close")
+	}
+}
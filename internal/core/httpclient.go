@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -19,6 +20,11 @@ func SetHTTPClientLogger(logger *log.Logger) {
 
 // NewHTTPClientWithProxy creates a new HTTP client with optional proxy support
 func NewHTTPClientWithProxy(proxyURLStr string) (*http.Client, error) {
+	return newHTTPClient(proxyURLStr, nil)
+}
+
+// newHTTPClient creates the HTTP client, throttling its connections if limiter is set
+func newHTTPClient(proxyURLStr string, limiter *bandwidthLimiter) (*http.Client, error) {
 	// Create the base transport with default values
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.TLSClientConfig.InsecureSkipVerify = false
@@ -33,6 +39,10 @@ func NewHTTPClientWithProxy(proxyURLStr string) (*http.Client, error) {
 		transport.TLSClientConfig.InsecureSkipVerify = true
 	}
 
+	if limiter != nil {
+		transport.DialContext = limiter.dialContext(transport.DialContext)
+	}
+
 	// Create retryable client with proper configuration
 	retryClient := retryablehttp.NewClient()
 	retryClient.RetryMax = 3
@@ -51,5 +61,15 @@ func NewHTTPClientWithProxy(proxyURLStr string) (*http.Client, error) {
 	// Important: Configure the retry policy to retry on connection errors
 	retryClient.CheckRetry = retryablehttp.ErrorPropagatedRetryPolicy
 
+	// Once retries run out, report the last response as a StatusError so callers can
+	// tell throttling and server errors apart and see the Retry-After delay
+	retryClient.ErrorHandler = func(resp *http.Response, err error, numTries int) (*http.Response, error) {
+		if resp != nil {
+			defer resp.Body.Close()
+			return nil, newStatusError(resp)
+		}
+		return nil, fmt.Errorf("giving up after %d attempt(s): %w", numTries, err)
+	}
+
 	return retryClient.StandardClient(), nil
 }
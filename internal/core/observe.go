@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// respBodyLimit caps how much of an error response body is kept in a StatusError
+const respBodyLimit = 64 * 1024
+
+// StatusError is returned for responses with a non-2xx status
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Delay asked for by the server's Retry-After header, 0 if none
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// RejectedError is returned when the API answered but refused a request or sent a
+// response that can't be used. Sending the same request again gets the same answer.
+type RejectedError struct {
+	Msg string
+	Err error // Underlying error, if any
+}
+
+func (e *RejectedError) Error() string {
+	if e.Err != nil {
+		return e.Msg + ": " + e.Err.Error()
+	}
+	return e.Msg
+}
+
+func (e *RejectedError) Unwrap() error { return e.Err }
+
+// newStatusError reads the body of a failed response into a StatusError
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, respBodyLimit))
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(0, time.Until(t))
+	}
+	return 0
+}
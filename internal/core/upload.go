@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/viperadnan-git/go-gpm/internal/pb"
@@ -14,7 +17,12 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// hashCheckConcurrency is the number of HashCheck requests kept in flight by FindRemoteMediaByHashes
+const hashCheckConcurrency = 8
+
 // GetUploadToken obtains a file upload token from the Google Photos API
+// The session is started with the resumable protocol, so an interrupted upload
+// can be queried with QueryUploadOffset and continued with ResumeUploadReader.
 func (a *Api) GetUploadToken(sha1HashBase64 string, fileSize int64) (string, error) {
 	requestBody := pb.GetUploadToken{
 		F1:            2,
@@ -36,8 +44,11 @@ func (a *Api) GetUploadToken(sha1HashBase64 string, fileSize int64) (string, err
 		WithCommonHeaders(),
 		WithStatusCheck(),
 		WithHeaders(map[string]string{
-			"X-Goog-Hash":             "sha1=" + sha1HashBase64,
-			"X-Upload-Content-Length": strconv.Itoa(int(fileSize)),
+			"X-Goog-Hash":                         "sha1=" + sha1HashBase64,
+			"X-Upload-Content-Length":             strconv.FormatInt(fileSize, 10),
+			"X-Goog-Upload-Protocol":              "resumable",
+			"X-Goog-Upload-Command":               "start",
+			"X-Goog-Upload-Header-Content-Length": strconv.FormatInt(fileSize, 10),
 		}),
 	)
 	if err != nil {
@@ -45,6 +56,12 @@ func (a *Api) GetUploadToken(sha1HashBase64 string, fileSize int64) (string, err
 	}
 
 	uploadToken := resp.Header.Get("X-GUploader-UploadID")
+	if uploadToken == "" {
+		// Resumable sessions may only name their upload URL
+		if u, err := url.Parse(resp.Header.Get("X-Goog-Upload-URL")); err == nil {
+			uploadToken = u.Query().Get("upload_id")
+		}
+	}
 	if uploadToken == "" {
 		return "", errors.New("response missing X-GUploader-UploadID header")
 	}
@@ -54,6 +71,57 @@ func (a *Api) GetUploadToken(sha1HashBase64 string, fileSize int64) (string, err
 
 // FindRemoteMediaByHash checks the library for existing files with the given hash
 func (a *Api) FindRemoteMediaByHash(sha1Hash []byte) (string, error) {
+	return a.findRemoteMediaByHash(context.Background(), sha1Hash)
+}
+
+// FindRemoteMediaByHashes checks the library for many hashes at once
+// Returns a map of dedup key to media key containing only the hashes that exist.
+// The HashCheck endpoint takes a single hash per request, so lookups are pipelined
+// over a fixed number of concurrent requests. On error the map still holds the
+// matches found before the first failure.
+func (a *Api) FindRemoteMediaByHashes(ctx context.Context, sha1Hashes [][]byte) (map[string]string, error) {
+	found := make(map[string]string)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	hashChan := make(chan []byte)
+	for range min(hashCheckConcurrency, len(sha1Hashes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range hashChan {
+				mediaKey, err := a.findRemoteMediaByHash(ctx, hash)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if mediaKey != "" {
+					found[SHA1ToDedupeKey(hash)] = mediaKey
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, hash := range sha1Hashes {
+		if ctx.Err() != nil {
+			break
+		}
+		hashChan <- hash
+	}
+	close(hashChan)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return found, firstErr
+}
+
+func (a *Api) findRemoteMediaByHash(ctx context.Context, sha1Hash []byte) (string, error) {
 	requestBody := pb.HashCheck{
 		Field1: &pb.HashCheckField1Type{
 			Field1: &pb.HashCheckField1TypeField1Type{
@@ -68,6 +136,7 @@ func (a *Api) FindRemoteMediaByHash(sha1Hash []byte) (string, error) {
 		"https://photosdata-pa.googleapis.com/6439526531001121323/5084965799730810217",
 		&requestBody,
 		&response,
+		WithContext(ctx),
 		WithAuth(),
 		WithCommonHeaders(),
 		WithStatusCheck(),
@@ -78,25 +147,61 @@ func (a *Api) FindRemoteMediaByHash(sha1Hash []byte) (string, error) {
 	return response.GetMediaKey(), nil
 }
 
+// uploadURL builds the upload endpoint URL for an upload token
+func uploadURL(uploadToken string) string {
+	return "https://photos.googleapis.com/data/upload/uploadmedia/interactive?upload_id=" + uploadToken
+}
+
+// ProgressFunc receives the number of bytes processed so far and the total (0 if unknown)
+type ProgressFunc func(done, total int64)
+
 // UploadFile uploads a file to Google Photos using the provided upload token
 func (a *Api) UploadFile(ctx context.Context, filePath string, uploadToken string) (*pb.CommitToken, error) {
+	return a.ResumeUploadFile(ctx, filePath, uploadToken, 0, nil)
+}
+
+// ResumeUploadFile uploads a file starting at the given byte offset
+// An offset of 0 sends the whole file, otherwise only the remaining bytes are sent.
+// The whole rest is sent in one request, which finalizes the session.
+// progress, if set, is called as the body is sent with the offset included in done.
+func (a *Api) ResumeUploadFile(ctx context.Context, filePath string, uploadToken string, offset int64, progress ProgressFunc) (*pb.CommitToken, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
 
-	uploadURL := "https://photos.googleapis.com/data/upload/uploadmedia/interactive?upload_id=" + uploadToken
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error accessing file: %w", err)
+	}
+	return a.ResumeUploadReader(ctx, file, info.Size(), uploadToken, offset, progress)
+}
+
+// ResumeUploadReader is ResumeUploadFile for content of the given size read from r
+func (a *Api) ResumeUploadReader(ctx context.Context, r io.ReaderAt, size int64, uploadToken string, offset int64, progress ProgressFunc) (*pb.CommitToken, error) {
+	headers := map[string]string{
+		"X-Goog-Upload-Command": "upload, finalize",
+		"X-Goog-Upload-Offset":  strconv.FormatInt(offset, 10),
+	}
+
+	body := &uploadBody{
+		section:  io.NewSectionReader(r, offset, size-offset),
+		offset:   offset,
+		total:    size,
+		progress: progress,
+	}
 
 	bodyBytes, _, err := a.DoRequest(
-		uploadURL,
-		file,
+		uploadURL(uploadToken),
+		body,
 		WithMethod("PUT"),
 		WithContext(ctx),
 		WithAuth(),
 		WithCommonHeaders(),
 		WithStatusCheck(),
 		WithChunkedTransfer(),
+		WithHeaders(headers),
 	)
 	if err != nil {
 		return nil, err
@@ -104,12 +209,66 @@ func (a *Api) UploadFile(ctx context.Context, filePath string, uploadToken strin
 
 	var commitToken pb.CommitToken
 	if err := proto.Unmarshal(bodyBytes, &commitToken); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+		return nil, &RejectedError{Msg: "failed to unmarshal protobuf", Err: err}
 	}
 
 	return &commitToken, nil
 }
 
+// uploadBody streams the remainder of a file as a request body and reports progress.
+// Being seekable, it is rewound on retries instead of read into memory up front.
+type uploadBody struct {
+	section  *io.SectionReader
+	offset   int64 // Bytes already on the server before this request
+	total    int64
+	progress ProgressFunc
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.section.Read(p)
+	if n > 0 && b.progress != nil {
+		pos, _ := b.section.Seek(0, io.SeekCurrent)
+		b.progress(b.offset+pos, b.total)
+	}
+	return n, err
+}
+
+func (b *uploadBody) Seek(offset int64, whence int) (int64, error) {
+	return b.section.Seek(offset, whence)
+}
+
+func (b *uploadBody) Close() error { return nil }
+
+// QueryUploadOffset asks the server how many bytes it has received for an upload token
+// Returns the committed offset and whether the upload session is already finalized
+func (a *Api) QueryUploadOffset(ctx context.Context, uploadToken string) (int64, bool, error) {
+	_, resp, err := a.DoRequest(
+		uploadURL(uploadToken),
+		nil,
+		WithContext(ctx),
+		WithAuth(),
+		WithCommonHeaders(),
+		WithStatusCheck(),
+		WithHeaders(map[string]string{
+			"X-Goog-Upload-Command": "query",
+		}),
+	)
+	if err != nil {
+		return 0, false, err
+	}
+
+	received := resp.Header.Get("X-Goog-Upload-Size-Received")
+	if received == "" {
+		return 0, false, errors.New("response missing X-Goog-Upload-Size-Received header")
+	}
+	offset, err := strconv.ParseInt(received, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid upload offset %q: %w", received, err)
+	}
+
+	return offset, resp.Header.Get("X-Goog-Upload-Status") == "final", nil
+}
+
 // CommitUpload commits the upload to Google Photos and returns the media key
 // qualityStr: "original" or "storage-saver" (empty string uses Api default)
 // useQuota: override Api default if true
@@ -181,12 +340,12 @@ func (a *Api) CommitUpload(
 	}
 
 	if response.GetField1() == nil || response.GetField1().GetField3() == nil {
-		return "", fmt.Errorf("upload rejected by API: invalid response structure")
+		return "", &RejectedError{Msg: "upload rejected by API: invalid response structure"}
 	}
 
 	mediaKey := response.GetField1().GetField3().GetMediaKey()
 	if mediaKey == "" {
-		return "", fmt.Errorf("upload rejected by API: no media key returned")
+		return "", &RejectedError{Msg: "upload rejected by API: no media key returned"}
 	}
 
 	return mediaKey, nil
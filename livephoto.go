@@ -0,0 +1,154 @@
+package gpm
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// LivePhotoVideo selects what happens to the video half of a Live Photo
+type LivePhotoVideo string
+
+const (
+	LivePhotoVideoUpload  LivePhotoVideo = "upload"  // Upload it right after the still (default)
+	LivePhotoVideoArchive LivePhotoVideo = "archive" // Upload it and archive it, keeping it out of the timeline
+	LivePhotoVideoSkip    LivePhotoVideo = "skip"    // Leave it out, only the still is uploaded
+)
+
+// LivePhotoOptions pairs the still and video halves of Live Photos, see UploadOptions.LivePhotos.
+// Files in the same directory pair up by the ContentIdentifier Apple writes into both
+// halves, which also finds renamed pairs. HEIC stills and videos that both lack one
+// pair up by name ("IMG_0001.HEIC" and "IMG_0001.MOV"); a JPEG and a video of the
+// same name are often unrelated, so JPEGs need the identifier.
+// The commit protocol has no way of linking the halves, so they are uploaded back to
+// back by one worker and left to the server to match by their ContentIdentifier.
+type LivePhotoOptions struct {
+	Video        LivePhotoVideo // Defaults to LivePhotoVideoUpload
+	VideoCaption string         // Caption template for the video half, empty captions it like any file
+}
+
+// video returns the video mode, defaulting to LivePhotoVideoUpload
+func (o *LivePhotoOptions) video() LivePhotoVideo {
+	if o == nil || o.Video == "" {
+		return LivePhotoVideoUpload
+	}
+	return o.Video
+}
+
+// Extensions of Live Photo halves
+var (
+	livePhotoStills = []string{".heic", ".heif", ".jpg", ".jpeg"}
+	livePhotoVideos = []string{".mov", ".mp4"}
+	livePhotoHEIC   = []string{".heic", ".heif"} // Stills that may pair by name alone
+)
+
+// isLivePhotoHalf reports whether path has the extension of a Live Photo still or video
+func isLivePhotoHalf(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return slices.Contains(livePhotoStills, ext) || slices.Contains(livePhotoVideos, ext)
+}
+
+// livePhotoPairs maps Live Photo stills to their videos
+type livePhotoPairs struct {
+	videos  map[string]string // Still path to video path
+	carried map[string]bool   // Videos that are uploaded with their still
+}
+
+func newLivePhotoPairs() *livePhotoPairs {
+	return &livePhotoPairs{videos: make(map[string]string), carried: make(map[string]bool)}
+}
+
+// video returns the video paired with the still at path, empty if there is none
+func (p *livePhotoPairs) video(path string) string {
+	if p == nil {
+		return ""
+	}
+	return p.videos[path]
+}
+
+// isCarried reports whether path is a video that is uploaded with its still
+func (p *livePhotoPairs) isCarried(path string) bool {
+	return p != nil && p.carried[path]
+}
+
+// add pairs the files called names in dir. Names that match up one still to one
+// video are paired if both carry the same identifier, or if neither carries one and
+// the still is HEIC; the files left over are paired by identifier alone.
+func (p *livePhotoPairs) add(dir string, names []string, identifier func(path string) string) {
+	type halves struct{ stills, videos []string }
+	byStem := make(map[string]*halves)
+	var stems []string
+	for _, name := range names {
+		ext := strings.ToLower(filepath.Ext(name))
+		isStill, isVideo := slices.Contains(livePhotoStills, ext), slices.Contains(livePhotoVideos, ext)
+		if !isStill && !isVideo {
+			continue
+		}
+		stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+		h, ok := byStem[stem]
+		if !ok {
+			h = &halves{}
+			byStem[stem] = h
+			stems = append(stems, stem)
+		}
+		if isStill {
+			h.stills = append(h.stills, name)
+		} else {
+			h.videos = append(h.videos, name)
+		}
+	}
+
+	ids := make(map[string]string)
+	id := func(name string) string {
+		v, ok := ids[name]
+		if !ok {
+			v = identifier(filepath.Join(dir, name))
+			ids[name] = v
+		}
+		return v
+	}
+	pair := func(still, video string) {
+		p.videos[filepath.Join(dir, still)] = filepath.Join(dir, video)
+		p.carried[filepath.Join(dir, video)] = true
+	}
+
+	var stills, videos []string
+	for _, stem := range stems {
+		h := byStem[stem]
+		if len(h.stills) == 1 && len(h.videos) == 1 {
+			a, b := id(h.stills[0]), id(h.videos[0])
+			heic := slices.Contains(livePhotoHEIC, strings.ToLower(filepath.Ext(h.stills[0])))
+			if (a != "" && a == b) || (a == "" && b == "" && heic) {
+				pair(h.stills[0], h.videos[0])
+				continue
+			}
+		}
+		stills = append(stills, h.stills...)
+		videos = append(videos, h.videos...)
+	}
+	if len(stills) == 0 || len(videos) == 0 {
+		return
+	}
+
+	byID := make(map[string]string)
+	for _, video := range videos {
+		if v := id(video); v != "" {
+			byID[v] = video
+		}
+	}
+	for _, still := range stills {
+		if video, ok := byID[id(still)]; ok && id(still) != "" {
+			pair(still, video)
+			delete(byID, id(still))
+		}
+	}
+}
+
+// livePhotoIdentifier returns the ContentIdentifier of a file, empty if it has none
+func livePhotoIdentifier(path string) string {
+	meta, err := ReadMediaMetadata(path)
+	if err != nil {
+		return ""
+	}
+	return meta.ContentIdentifier
+}
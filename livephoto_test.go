@@ -0,0 +1,83 @@
+package gpm
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+)
+
+func TestLivePhotoPairsAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		ids   map[string]string // File name to its ContentIdentifier, missing for none
+		want  map[string]string // Still to video
+		names []string
+	}{
+		{
+			name:  "HEIC without identifiers pairs by name",
+			names: []string{"IMG_0001.HEIC", "IMG_0001.MOV"},
+			want:  map[string]string{"IMG_0001.HEIC": "IMG_0001.MOV"},
+		},
+		{
+			name:  "JPEG without identifiers doesn't pair",
+			names: []string{"IMG_0001.JPG", "IMG_0001.MOV"},
+			want:  map[string]string{},
+		},
+		{
+			name:  "JPEG with matching identifiers",
+			names: []string{"IMG_0001.JPG", "IMG_0001.MOV"},
+			ids:   map[string]string{"IMG_0001.JPG": "A", "IMG_0001.MOV": "A"},
+			want:  map[string]string{"IMG_0001.JPG": "IMG_0001.MOV"},
+		},
+		{
+			name:  "JPEG with only the video identified",
+			names: []string{"IMG_0001.JPG", "IMG_0001.MOV"},
+			ids:   map[string]string{"IMG_0001.MOV": "A"},
+			want:  map[string]string{},
+		},
+		{
+			name:  "HEIC with only the still identified",
+			names: []string{"IMG_0001.HEIC", "IMG_0001.MOV"},
+			ids:   map[string]string{"IMG_0001.HEIC": "A"},
+			want:  map[string]string{},
+		},
+		{
+			name:  "different identifiers",
+			names: []string{"IMG_0001.HEIC", "IMG_0001.MOV"},
+			ids:   map[string]string{"IMG_0001.HEIC": "A", "IMG_0001.MOV": "B"},
+			want:  map[string]string{},
+		},
+		{
+			name:  "renamed pair by identifier",
+			names: []string{"beach.jpg", "IMG_0001.MOV", "clip.mov"},
+			ids:   map[string]string{"beach.jpg": "A", "IMG_0001.MOV": "A"},
+			want:  map[string]string{"beach.jpg": "IMG_0001.MOV"},
+		},
+		{
+			name:  "name mismatch falls back to identifiers",
+			names: []string{"IMG_0001.JPG", "IMG_0001.MOV", "IMG_0002.MOV"},
+			ids:   map[string]string{"IMG_0001.JPG": "A", "IMG_0001.MOV": "B", "IMG_0002.MOV": "A"},
+			want:  map[string]string{"IMG_0001.JPG": "IMG_0002.MOV"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := newLivePhotoPairs()
+			p.add(dir, tt.names, func(path string) string { return tt.ids[filepath.Base(path)] })
+
+			got := make(map[string]string)
+			for still, video := range p.videos {
+				got[filepath.Base(still)] = filepath.Base(video)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("pairs = %v, want %v", got, tt.want)
+			}
+			for _, video := range tt.want {
+				if !p.isCarried(filepath.Join(dir, video)) {
+					t.Errorf("%s not carried with its still", video)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package gpm
+
+import "os"
+
+// tryLock always succeeds on platforms without flock; sessions are then only
+// guarded within the process
+func tryLock(f *os.File) bool {
+	return true
+}
+
+// lockFile is a no-op on platforms without flock
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on platforms without flock
+func unlockFile(f *os.File) {}
@@ -2,7 +2,6 @@ package gpm
 
 import (
 	"fmt"
-	"sync"
 
 	"github.com/viperadnan-git/go-gpm/internal/core"
 )
@@ -13,7 +12,10 @@ type ApiConfig = core.ApiConfig
 // GooglePhotosAPI is the main API client for Google Photos operations
 type GooglePhotosAPI struct {
 	*core.Api
-	uploadMu sync.Mutex // Serializes upload batches
+	scheduler *uploadScheduler    // Transfer budget shared by concurrent uploads
+	disk      diskGate            // Shared by uploads in SerialDiskReads mode
+	sessions  *uploadSessionStore // Persisted resumable upload sessions
+	hashCache *HashCache          // Persisted file hashes
 }
 
 // NewGooglePhotosAPI creates a new Google Photos API client
@@ -22,7 +24,12 @@ func NewGooglePhotosAPI(cfg ApiConfig) (*GooglePhotosAPI, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &GooglePhotosAPI{Api: coreApi}, nil
+	return &GooglePhotosAPI{
+		Api:       coreApi,
+		scheduler: newUploadScheduler(cfg.UploadWorkers),
+		sessions:  newUploadSessionStore(cfg.CacheDir),
+		hashCache: NewHashCache(cfg.CacheDir),
+	}, nil
 }
 
 // DownloadThumbnail downloads a thumbnail to the specified output path
@@ -48,5 +55,5 @@ func (g *GooglePhotosAPI) DownloadMedia(mediaKey string, outputPath string) (str
 	if downloadURL == "" {
 		return "", fmt.Errorf("no download URL available")
 	}
-	return DownloadFile(downloadURL, outputPath)
+	return g.DownloadURL(downloadURL, outputPath)
 }
@@ -0,0 +1,276 @@
+package gpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how much of a file is read for detection, enough for two MPEG-TS packets
+const sniffLen = 512
+
+// extensionMediaTypes maps supported extensions to the MIME type reported when a file
+// is accepted by extension alone, and refines TIFF-based RAW formats
+var extensionMediaTypes = map[string]string{
+	"avif": "image/avif", "bmp": "image/bmp", "gif": "image/gif", "heic": "image/heic",
+	"ico": "image/x-icon", "jpg": "image/jpeg", "jpeg": "image/jpeg", "png": "image/png",
+	"tiff": "image/tiff", "webp": "image/webp",
+	"cr2": "image/x-canon-cr2", "cr3": "image/x-canon-cr3", "nef": "image/x-nikon-nef",
+	"arw": "image/x-sony-arw", "orf": "image/x-olympus-orf", "raf": "image/x-fuji-raf",
+	"rw2": "image/x-panasonic-rw2", "pef": "image/x-pentax-pef", "sr2": "image/x-sony-sr2",
+	"dng": "image/x-adobe-dng",
+	"3gp": "video/3gpp", "3g2": "video/3gpp2", "asf": "video/x-ms-asf", "avi": "video/x-msvideo",
+	"divx": "video/x-msvideo", "m2t": "video/mp2t", "m2ts": "video/mp2t", "m4v": "video/x-m4v",
+	"mkv": "video/x-matroska", "mmv": "video/x-mmv", "mod": "video/mpeg", "mov": "video/quicktime",
+	"mp4": "video/mp4", "mpg": "video/mpeg", "mpeg": "video/mpeg", "mts": "video/mp2t",
+	"tod": "video/mpeg", "wmv": "video/x-ms-wmv", "ts": "video/mp2t",
+}
+
+// unsniffableExtensions have no reliable signature, so files with these extensions
+// are accepted even when their content isn't recognised
+var unsniffableExtensions = map[string]bool{
+	"ico": true, "m2t": true, "m2ts": true, "mts": true, "ts": true,
+	"mmv": true, "mod": true, "tod": true,
+}
+
+// DetectMediaType identifies a photo or video by its leading bytes
+// Returns the MIME type, or "" if the content is not a recognised media format
+func DetectMediaType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return sniffMediaType(header[:n], fileExt(path)), nil
+}
+
+// fileExt returns the lower-case extension without the dot
+func fileExt(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// resolveMediaType decides whether a file is uploadable media and returns its MIME type.
+// Content detection wins; files that can't be read or recognised fall back to their
+// extension only if that format has no reliable signature.
+func resolveMediaType(path string) (string, bool) {
+	mediaType, err := DetectMediaType(path)
+	return chooseMediaType(path, mediaType, err)
+}
+
+// resolveHeaderMediaType is resolveMediaType for content that isn't a file on disk,
+// given its leading bytes (up to sniffLen) under the name path
+func resolveHeaderMediaType(path string, header []byte) (string, bool) {
+	return chooseMediaType(path, sniffMediaType(header, fileExt(path)), nil)
+}
+
+// chooseMediaType applies the fallback of resolveMediaType to a detection result
+func chooseMediaType(path, mediaType string, err error) (string, bool) {
+	if err == nil && mediaType != "" {
+		return mediaType, true
+	}
+	if (err != nil || unsniffableExtensions[fileExt(path)]) && isSupportedByGooglePhotos(path) {
+		return extensionMediaTypes[fileExt(path)], true
+	}
+	return "", false
+}
+
+// sniffMediaType matches magic bytes for every format in isSupportedByGooglePhotos
+// ext is only used to name TIFF-based RAW formats that share the plain TIFF header
+func sniffMediaType(b []byte, ext string) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(b, []byte("GIF87a")), bytes.HasPrefix(b, []byte("GIF89a")):
+		return "image/gif"
+	case len(b) >= 12 && bytes.Equal(b[:4], []byte("RIFF")) && bytes.Equal(b[8:12], []byte("WEBP")):
+		return "image/webp"
+	case len(b) >= 12 && bytes.Equal(b[:4], []byte("RIFF")) && bytes.Equal(b[8:12], []byte("AVI ")):
+		return "video/x-msvideo"
+	case isBMP(b):
+		return "image/bmp"
+	case bytes.HasPrefix(b, []byte{0x00, 0x00, 0x01, 0x00}) && len(b) >= 6 && b[4] > 0:
+		return "image/x-icon"
+	case bytes.HasPrefix(b, []byte("FUJIFILMCCD-RAW")):
+		return "image/x-fuji-raf"
+	case bytes.HasPrefix(b, []byte("IIRO")), bytes.HasPrefix(b, []byte("IIRS")), bytes.HasPrefix(b, []byte("MMOR")):
+		return "image/x-olympus-orf"
+	case bytes.HasPrefix(b, []byte("IIU\x00")):
+		return "image/x-panasonic-rw2"
+	case bytes.HasPrefix(b, []byte("II*\x00")), bytes.HasPrefix(b, []byte("MM\x00*")):
+		if len(b) >= 10 && b[8] == 'C' && b[9] == 'R' {
+			return "image/x-canon-cr2"
+		}
+		// NEF, ARW, PEF, SR2 and DNG are all plain TIFF containers
+		switch ext {
+		case "nef", "arw", "pef", "sr2", "dng":
+			return extensionMediaTypes[ext]
+		}
+		return "image/tiff"
+	case bytes.HasPrefix(b, []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}):
+		if ext == "wmv" {
+			return "video/x-ms-wmv"
+		}
+		return "video/x-ms-asf"
+	case bytes.HasPrefix(b, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(b[:min(len(b), 64)], []byte("matroska")) {
+			return "video/x-matroska"
+		}
+		return "" // WebM and other EBML documents
+	case bytes.HasPrefix(b, []byte{0x00, 0x00, 0x01, 0xBA}), bytes.HasPrefix(b, []byte{0x00, 0x00, 0x01, 0xB3}):
+		return "video/mpeg"
+	case isTransportStream(b, 0), isTransportStream(b, 4):
+		return "video/mp2t"
+	}
+	return sniffISOBMFF(b)
+}
+
+// isBMP checks the "BM" magic plus a known DIB header size, since two bytes alone are too weak
+func isBMP(b []byte) bool {
+	if len(b) < 18 || b[0] != 'B' || b[1] != 'M' {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(b[14:18]) {
+	case 12, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+// isTransportStream looks for MPEG-TS sync bytes at the start of consecutive packets
+// A prefix of 4 matches M2TS/MTS, which put a timestamp before each 188-byte packet
+func isTransportStream(b []byte, prefix int) bool {
+	stride := 188 + prefix
+	if len(b) <= prefix+stride {
+		return false
+	}
+	if b[prefix] != 0x47 || b[prefix+stride] != 0x47 {
+		return false
+	}
+	return len(b) <= prefix+2*stride || b[prefix+2*stride] == 0x47
+}
+
+// mp4Brands are ftyp brands of MP4 video. Other brands, of audio, 3D models or
+// anything else built on ISO BMFF, are not media Google Photos takes.
+var mp4Brands = map[string]bool{
+	"isom": true, "iso2": true, "iso3": true, "iso4": true, "iso5": true, "iso6": true,
+	"iso7": true, "iso8": true, "iso9": true, "mp41": true, "mp42": true, "mp71": true,
+	"avc1": true, "hvc1": true, "dash": true, "mmp4": true, "f4v ": true, "MSNV": true,
+	"XAVC": true, "CAEP": true, "kddi": true, "NDAS": true, "NDSC": true, "NDSH": true,
+	"NDSM": true, "NDSP": true, "NDSS": true, "NDXC": true, "NDXH": true, "NDXM": true,
+	"NDXP": true, "NDXS": true,
+}
+
+// sniffISOBMFF identifies MP4, QuickTime, 3GP, HEIF/HEIC, AVIF and CR3 files by their
+// ftyp major and compatible brands
+func sniffISOBMFF(b []byte) string {
+	if len(b) < 12 {
+		return ""
+	}
+	boxType := string(b[4:8])
+	if boxType != "ftyp" {
+		// Old QuickTime files may start directly with a movie atom
+		switch boxType {
+		case "moov", "mdat", "wide", "free", "skip", "pnot":
+			if isQuickTimeAtom(b) {
+				return "video/quicktime"
+			}
+		}
+		return ""
+	}
+
+	boxLen := int(binary.BigEndian.Uint32(b[0:4]))
+	if boxLen < 16 || boxLen > len(b) {
+		boxLen = len(b)
+	}
+	brands := []string{string(b[8:12])}
+	for i := 16; i+4 <= boxLen; i += 4 {
+		brands = append(brands, string(b[i:i+4]))
+	}
+
+	has := func(want ...string) bool {
+		for _, brand := range brands {
+			for _, w := range want {
+				if brand == w {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	major := brands[0]
+	switch {
+	case major == "crx ":
+		return "image/x-canon-cr3"
+	case has("avif", "avis"):
+		return "image/avif"
+	case has("heic", "heix", "heim", "heis", "hevc", "hevx"):
+		return "image/heic"
+	case major == "mif1" || major == "msf1":
+		return "image/heif"
+	case major == "qt  ":
+		return "video/quicktime"
+	case strings.HasPrefix(major, "3g2"):
+		return "video/3gpp2"
+	case strings.HasPrefix(major, "3gp"), strings.HasPrefix(major, "3gs"), strings.HasPrefix(major, "3ge"):
+		return "video/3gpp"
+	case strings.HasPrefix(major, "M4V"):
+		return "video/x-m4v"
+	case has("M4A ", "M4B ", "M4P ", "F4A ", "F4B "):
+		return "" // Audio only
+	case mp4Brands[major]:
+		return "video/mp4"
+	case has("qt  "):
+		return "video/quicktime"
+	}
+	for _, brand := range brands[1:] {
+		if mp4Brands[brand] {
+			return "video/mp4"
+		}
+	}
+	return ""
+}
+
+// quickTimeMaxHeaderAtom bounds the size of atoms other than mdat at the start of a
+// file. Movie headers are far smaller, text that happens to contain "moov" is not.
+const quickTimeMaxHeaderAtom = 1 << 28
+
+// isQuickTimeAtom checks that b starts with an atom of a plausible size, followed by
+// another atom if the first one ends within b, since a four-letter word at bytes 4:8
+// is too weak on its own
+func isQuickTimeAtom(b []byte) bool {
+	size, minSize := uint64(binary.BigEndian.Uint32(b[0:4])), uint64(8)
+	mdat := string(b[4:8]) == "mdat"
+	switch size {
+	case 0: // Extends to the end of the file
+		return mdat
+	case 1: // 64-bit size follows the type
+		if len(b) < 16 {
+			return false
+		}
+		size, minSize = binary.BigEndian.Uint64(b[8:16]), 16
+	}
+	if size < minSize || (!mdat && size >= quickTimeMaxHeaderAtom) {
+		return false
+	}
+	if size+8 > uint64(len(b)) {
+		return true
+	}
+	for _, c := range b[size+4 : size+8] {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package gpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ftyp builds an ftyp box with the given major and compatible brands
+func ftyp(major string, compatible ...string) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(16+4*len(compatible)))
+	b = append(b, "ftyp"+major+"\x00\x00\x00\x00"...)
+	for _, brand := range compatible {
+		b = append(b, brand...)
+	}
+	return b
+}
+
+// atom builds a QuickTime atom header of the given size
+func atom(size uint32, kind string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, size), kind...)
+}
+
+func TestSniffMediaType(t *testing.T) {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	bmp := append([]byte("BM"), make([]byte, 16)...)
+	binary.LittleEndian.PutUint32(bmp[14:], 40)
+	ts := make([]byte, 3*188+1)
+	ts[0], ts[188], ts[376] = 0x47, 0x47, 0x47
+	m2ts := make([]byte, 3*192+5)
+	m2ts[4], m2ts[196], m2ts[388] = 0x47, 0x47, 0x47
+
+	tests := []struct {
+		name   string
+		header []byte
+		ext    string
+		want   string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE1}, "jpg", "image/jpeg"},
+		{"jpeg named png", []byte{0xFF, 0xD8, 0xFF, 0xE0}, "png", "image/jpeg"},
+		{"png", []byte("\x89PNG\r\n\x1a\n...."), "png", "image/png"},
+		{"gif", []byte("GIF89a"), "gif", "image/gif"},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "webp", "image/webp"},
+		{"avi", []byte("RIFF\x00\x00\x00\x00AVI LIST"), "avi", "video/x-msvideo"},
+		{"wav is not media", []byte("RIFF\x00\x00\x00\x00WAVEfmt "), "wav", ""},
+		{"bmp", bmp, "bmp", "image/bmp"},
+		{"BM text", []byte("BM is not a bitmap header"), "bmp", ""},
+		{"icon", []byte{0, 0, 1, 0, 1, 0}, "ico", "image/x-icon"},
+		{"icon without images", []byte{0, 0, 1, 0, 0, 0}, "ico", ""},
+		{"tiff", tiff, "tiff", "image/tiff"},
+		{"dng", tiff, "dng", "image/x-adobe-dng"},
+		{"cr2", []byte("II*\x00\x10\x00\x00\x00CR\x02\x00"), "cr2", "image/x-canon-cr2"},
+		{"raf", []byte("FUJIFILMCCD-RAW 0201"), "raf", "image/x-fuji-raf"},
+		{"orf", []byte("IIRO\x08\x00\x00\x00"), "orf", "image/x-olympus-orf"},
+		{"rw2", []byte("IIU\x00\x18\x00\x00\x00"), "rw2", "image/x-panasonic-rw2"},
+		{"wmv", []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}, "wmv", "video/x-ms-wmv"},
+		{"asf", []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}, "asf", "video/x-ms-asf"},
+		{"mkv", append([]byte{0x1A, 0x45, 0xDF, 0xA3}, "\x42\x82\x88matroska"...), "mkv", "video/x-matroska"},
+		{"webm", append([]byte{0x1A, 0x45, 0xDF, 0xA3}, "\x42\x82\x84webm"...), "webm", ""},
+		{"mpeg program stream", []byte{0, 0, 1, 0xBA, 0x44}, "mpg", "video/mpeg"},
+		{"transport stream", ts, "ts", "video/mp2t"},
+		{"m2ts", m2ts, "m2ts", "video/mp2t"},
+		{"lone sync byte", []byte{0x47, 0x40, 0x00, 0x10}, "ts", ""},
+		{"mp4", ftyp("isom", "isom", "avc1"), "mp4", "video/mp4"},
+		{"heic", ftyp("heic", "mif1", "heic"), "heic", "image/heic"},
+
+		// Truncated and odd headers
+		{"empty", nil, "jpg", ""},
+		{"short jpeg", []byte{0xFF, 0xD8}, "jpg", ""},
+		{"short riff", []byte("RIFF\x00\x00"), "webp", ""},
+		{"short bmp", []byte("BM\x00\x00"), "bmp", ""},
+		{"short ftyp", []byte("\x00\x00\x00\x18ftyp"), "mp4", ""},
+		{"text", []byte("hello, world"), "jpg", ""},
+		{"zeros", make([]byte, 512), "mp4", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffMediaType(tt.header, tt.ext); got != tt.want {
+				t.Errorf("sniffMediaType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffISOBMFF(t *testing.T) {
+	moov := append(atom(16, "moov"), atom(8, "mvhd")...)
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"mp4", ftyp("mp42", "mp42", "isom"), "video/mp4"},
+		{"dash", ftyp("dash", "iso6", "mp41"), "video/mp4"},
+		{"unknown major with mp4 compatible", ftyp("XYZ1", "XYZ1", "isom"), "video/mp4"},
+		{"quicktime", ftyp("qt  ", "qt  "), "video/quicktime"},
+		{"quicktime compatible", ftyp("XYZ1", "qt  "), "video/quicktime"},
+		{"m4v", ftyp("M4V ", "M4V ", "mp42"), "video/x-m4v"},
+		{"3gp", ftyp("3gp4", "isom", "3gp4"), "video/3gpp"},
+		{"3g2", ftyp("3g2a", "3g2a"), "video/3gpp2"},
+		{"heic", ftyp("heic", "mif1", "heic"), "image/heic"},
+		{"heic compatible", ftyp("mif1", "mif1", "heix"), "image/heic"},
+		{"heif", ftyp("mif1", "mif1"), "image/heif"},
+		{"avif", ftyp("avif", "avif", "mif1"), "image/avif"},
+		{"cr3", ftyp("crx ", "crx ", "isom"), "image/x-canon-cr3"},
+
+		// Audio and other non-media ISO BMFF files
+		{"m4a", ftyp("M4A ", "M4A ", "mp42", "isom"), ""},
+		{"m4b", ftyp("M4B ", "M4B ", "mp42", "isom"), ""},
+		{"m4a with mp4 major", ftyp("mp42", "M4A ", "isom"), ""},
+		{"3mf", ftyp("3mf ", "3mf "), ""},
+		{"unknown brand", ftyp("abcd"), ""},
+
+		// Files starting with a QuickTime atom
+		{"moov", moov, "video/quicktime"},
+		{"mdat to end of file", append(atom(0, "mdat"), 0, 0, 0, 0), "video/quicktime"},
+		{"wide then mdat", append(atom(8, "wide"), atom(1024, "mdat")...), "video/quicktime"},
+		{"64-bit mdat", append(atom(1, "mdat"), 0, 0, 0, 0, 0, 0, 0x10, 0), "video/quicktime"},
+		{"atom size too small", append(atom(4, "moov"), make([]byte, 8)...), ""},
+		{"free to end of file", append(atom(0, "free"), make([]byte, 8)...), ""},
+		{"64-bit size too small", append(atom(1, "mdat"), make([]byte, 8)...), ""},
+		{"text with atom name", []byte("The moov atom is missing"), ""},
+		{"garbage after atom", append(atom(8, "skip"), 0, 0, 0, 8, 0, 1, 2, 3), ""},
+
+		{"truncated", []byte("\x00\x00\x00\x14ftyp"), ""},
+		{"ftyp without brands", []byte("\x00\x00\x00\x0cftypisom"), "video/mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffISOBMFF(tt.header); got != tt.want {
+				t.Errorf("sniffISOBMFF(% x) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveMediaType(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+		wantOK  bool
+	}{
+		{"photo.jpg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, "image/jpeg", true},
+		{"renamed.mp4", []byte{0xFF, 0xD8, 0xFF, 0xE0}, "image/jpeg", true},
+		{"song.m4a", ftyp("M4A ", "M4A ", "mp42"), "", false},
+		{"song.mp4", ftyp("M4A ", "M4A ", "mp42"), "", false},
+		{"notes.jpg", []byte("not a photo"), "", false},
+		{"clip.mts", []byte("no signature"), "video/mp2t", true},
+		{"notes.txt", []byte("text"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := resolveMediaType(path)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("resolveMediaType() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDetectMediaTypeShortFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiny.jpg")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0xFF}, 2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DetectMediaType(path)
+	if err != nil || got != "" {
+		t.Errorf("DetectMediaType() = %q, %v, want no type and no error", got, err)
+	}
+}
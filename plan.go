@@ -0,0 +1,269 @@
+package gpm
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/viperadnan-git/go-gpm/internal/core"
+)
+
+// PlanAction is what an upload would do with a file
+type PlanAction string
+
+const (
+	PlanUpload   PlanAction = "upload"
+	PlanSkip     PlanAction = "skip"     // Already in library, or identical to a file planned before it
+	PlanFiltered PlanAction = "filtered" // Left out by filters or walk options
+	PlanError    PlanAction = "error"    // Couldn't be read or hashed
+	PlanUnknown  PlanAction = "unknown"  // Couldn't be checked against the library, an upload would check it again
+)
+
+// PlannedFile is the outcome an upload would have for one path
+type PlannedFile struct {
+	Path      string     `json:"path"`
+	Action    PlanAction `json:"action"`
+	Reason    string     `json:"reason,omitempty"` // Why the file is filtered, failed or a duplicate
+	MediaType string     `json:"mediaType,omitempty"`
+	Size      int64      `json:"size,omitempty"`
+	DedupKey  string     `json:"dedupKey,omitempty"`
+	MediaKey  string     `json:"mediaKey,omitempty"` // Library item a skipped file matches
+	Albums    []string   `json:"albums,omitempty"`
+}
+
+// PlannedAlbum is an album an upload would create
+type PlannedAlbum struct {
+	Name  string `json:"name"`
+	Items int    `json:"items"`
+}
+
+// PlanSummary counts the files of an UploadPlan by action
+type PlanSummary struct {
+	Upload      int   `json:"upload"`
+	Skip        int   `json:"skip"`
+	Filtered    int   `json:"filtered"`
+	Errors      int   `json:"errors"`
+	Unknown     int   `json:"unknown"`
+	UploadBytes int64 `json:"uploadBytes"`
+}
+
+// UploadPlan describes what Upload would do with a set of paths
+type UploadPlan struct {
+	Files   []PlannedFile  `json:"files"`
+	Albums  []PlannedAlbum `json:"albums,omitempty"`
+	Summary PlanSummary    `json:"summary"`
+}
+
+// PlanUpload walks, filters and hashes paths like Upload and checks the hashes against
+// the library, but uploads and changes nothing, not even the local hash cache.
+// albumName gives the album each uploaded or skipped file would be added to, nil
+// for none; the albums from opts.Metadata and XMP rules are added to it. The XMP of
+// archive members isn't read.
+func (g *GooglePhotosAPI) PlanUpload(ctx context.Context, paths []string, opts UploadOptions, albumName func(path string) string) (*UploadPlan, error) {
+	filter, err := newPathFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+	plan := &UploadPlan{Files: []PlannedFile{}}
+	var found []int // Indexes into plan.Files of files that pass the filters
+	w := newWalker(filter, opts)
+	w.gate = g.diskGate(opts)
+	w.skipped = func(path, reason string) {
+		plan.Files = append(plan.Files, PlannedFile{Path: path, Action: PlanFiltered, Reason: reason})
+	}
+	w.walk(paths, func(file walkedFile) bool {
+		if file.member != nil {
+			// Archive members can only be read while the walk is on them
+			plan.Files = append(plan.Files, planMember(ctx, file))
+			if plan.Files[len(plan.Files)-1].Action == PlanUpload {
+				found = append(found, len(plan.Files)-1)
+			}
+			return ctx.Err() == nil
+		}
+		found = append(found, len(plan.Files))
+		plan.Files = append(plan.Files, PlannedFile{Path: file.path, Action: PlanUpload, MediaType: file.mediaType})
+		// Live Photo halves are planned like separate files
+		if file.video != "" {
+			if opts.LivePhotos.video() == LivePhotoVideoSkip {
+				plan.Files = append(plan.Files, PlannedFile{Path: file.video, Action: PlanFiltered, Reason: "live photo video"})
+			} else {
+				found = append(found, len(plan.Files))
+				plan.Files = append(plan.Files, PlannedFile{Path: file.video, Action: PlanUpload, MediaType: file.videoType})
+			}
+		}
+		return ctx.Err() == nil
+	}, func(path string, err error) {
+		plan.Files = append(plan.Files, PlannedFile{Path: path, Action: PlanError, Reason: err.Error()})
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Hash the way an upload would
+	run := &uploadRun{gate: g.diskGate(opts), control: opts.Control, dryRun: true}
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for _, i := range found {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	runWorkers(ctx, indexes, opts.hashWorkers(), func(_ int, i int) {
+		f := &plan.Files[i]
+		if f.DedupKey != "" {
+			return
+		}
+		if f.MediaType == "" {
+			run.gate.do(func() { f.MediaType, _ = resolveMediaType(f.Path) })
+		}
+		if info, err := os.Stat(f.Path); err == nil {
+			f.Size = info.Size()
+		}
+		sha1Hash, err := g.hashFile(ctx, f.Path, run, nil)
+		if err != nil {
+			f.Action, f.Reason = PlanError, fmt.Sprintf("hash error: %v", err)
+			return
+		}
+		f.DedupKey = core.SHA1ToDedupeKey(sha1Hash)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !opts.ForceUpload {
+		g.planSkips(ctx, plan, found)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	planDuplicates(plan, found)
+
+	albumIndex := make(map[string]int)
+	for i := range plan.Files {
+		f := &plan.Files[i]
+		switch f.Action {
+		case PlanUpload:
+			plan.Summary.Upload++
+			plan.Summary.UploadBytes += f.Size
+		case PlanSkip:
+			plan.Summary.Skip++
+		case PlanUnknown:
+			plan.Summary.Unknown++
+		case PlanFiltered:
+			plan.Summary.Filtered++
+			continue
+		case PlanError:
+			plan.Summary.Errors++
+			continue
+		}
+		f.Albums = plannedAlbums(f.Path, opts, albumName, g.diskGate(opts))
+		for _, album := range f.Albums {
+			j, ok := albumIndex[album]
+			if !ok {
+				j = len(plan.Albums)
+				albumIndex[album] = j
+				plan.Albums = append(plan.Albums, PlannedAlbum{Name: album})
+			}
+			plan.Albums[j].Items++
+		}
+	}
+	return plan, nil
+}
+
+// plannedAlbums returns the albums a file would be added to: the one from albumName,
+// which may be nil, then those from its FileMetadata
+func plannedAlbums(path string, opts UploadOptions, albumName func(string) string, gate *diskGate) []string {
+	var albums []string
+	if albumName != nil {
+		if name := albumName(path); name != "" {
+			albums = append(albums, name)
+		}
+	}
+	if opts.Metadata == nil && opts.XMP == nil {
+		return albums
+	}
+	xmpPath := path
+	if isArchiveMember(path) {
+		xmpPath = ""
+	}
+	for _, name := range opts.fileMetadata(path, xmpPath, gate).Albums {
+		if name != "" && !slices.Contains(albums, name) {
+			albums = append(albums, name)
+		}
+	}
+	return albums
+}
+
+// planSkips marks the hashed files that are already in the library as skipped.
+// Files in a batch whose check fails are marked unknown, as an upload would check
+// them again; the rest of the plan goes on.
+func (g *GooglePhotosAPI) planSkips(ctx context.Context, plan *UploadPlan, found []int) {
+	var hashed []int
+	for _, i := range found {
+		if plan.Files[i].Action == PlanUpload {
+			hashed = append(hashed, i)
+		}
+	}
+	for start := 0; start < len(hashed) && ctx.Err() == nil; start += hashCheckBatchSize {
+		batch := hashed[start:min(start+hashCheckBatchSize, len(hashed))]
+		hashes := make([][]byte, 0, len(batch))
+		for _, i := range batch {
+			if sha1Hash, err := core.DedupeKeyToSHA1(plan.Files[i].DedupKey); err == nil {
+				hashes = append(hashes, sha1Hash)
+			}
+		}
+		existing, err := g.FindRemoteMediaByHashes(ctx, hashes)
+		if err != nil {
+			slog.Warn("remote existence check failed", "error", err)
+		}
+		for _, i := range batch {
+			f := &plan.Files[i]
+			switch {
+			case err != nil:
+				f.Action, f.Reason = PlanUnknown, fmt.Sprintf("existence check failed, would check: %v", err)
+			case existing[f.DedupKey] != "":
+				f.Action, f.MediaKey = PlanSkip, existing[f.DedupKey]
+			}
+		}
+	}
+}
+
+// planDuplicates marks all but the first of identical files as skipped, as Upload
+// only uploads one of them
+func planDuplicates(plan *UploadPlan, found []int) {
+	first := make(map[string]int)
+	for _, i := range found {
+		f := &plan.Files[i]
+		if f.Action != PlanUpload && f.Action != PlanSkip && f.Action != PlanUnknown {
+			continue
+		}
+		j, ok := first[f.DedupKey]
+		if !ok {
+			first[f.DedupKey] = i
+			continue
+		}
+		f.Action, f.MediaKey = PlanSkip, plan.Files[j].MediaKey
+		f.Reason = "duplicate of " + plan.Files[j].Path
+	}
+}
+
+// planMember hashes an archive member as the walk reaches it
+func planMember(ctx context.Context, file walkedFile) PlannedFile {
+	f := PlannedFile{Path: file.path, Action: PlanUpload, Size: file.member.size, MediaType: file.member.mediaType}
+	hash := sha1.New()
+	cw := &chunkedContextWriter{ctx: ctx, w: hash}
+	if _, err := io.CopyBuffer(cw, file.member.r, make([]byte, copyBufferSize)); err != nil {
+		f.Action, f.Reason = PlanError, fmt.Sprintf("read error: %v", err)
+		return f
+	}
+	f.DedupKey = core.SHA1ToDedupeKey(hash.Sum(nil))
+	return f
+}
@@ -0,0 +1,133 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/viperadnan-git/go-gpm/internal/core"
+)
+
+func TestPlanUploadAlbums(t *testing.T) {
+	dir := t.TempDir()
+	jpeg := []byte("\xFF\xD8\xFF\xE0jpeg")
+	for _, name := range []string{"trip/a.jpg", "trip/b.jpg", "home/c.jpg"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		// Distinct content so none is planned as a duplicate
+		if err := os.WriteFile(path, append(jpeg, name...), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	folder := func(path string) string { return filepath.Base(filepath.Dir(path)) }
+	metadata := func(path string) *FileMetadata {
+		if filepath.Base(path) == "a.jpg" {
+			return &FileMetadata{Albums: []string{"Favourites", "trip"}}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name      string
+		albumName func(string) string
+		metadata  func(string) *FileMetadata
+		want      map[string][]string // File name to its albums
+		albums    []PlannedAlbum
+	}{
+		{
+			name: "none",
+			want: map[string][]string{"a.jpg": nil, "b.jpg": nil, "c.jpg": nil},
+		},
+		{
+			name:      "album name",
+			albumName: folder,
+			want:      map[string][]string{"a.jpg": {"trip"}, "b.jpg": {"trip"}, "c.jpg": {"home"}},
+			albums:    []PlannedAlbum{{"home", 1}, {"trip", 2}},
+		},
+		{
+			name:     "metadata",
+			metadata: metadata,
+			want:     map[string][]string{"a.jpg": {"Favourites", "trip"}, "b.jpg": nil, "c.jpg": nil},
+			albums:   []PlannedAlbum{{"Favourites", 1}, {"trip", 1}},
+		},
+		{
+			name:      "both",
+			albumName: folder,
+			metadata:  metadata,
+			want:      map[string][]string{"a.jpg": {"trip", "Favourites"}, "b.jpg": {"trip"}, "c.jpg": {"home"}},
+			albums:    []PlannedAlbum{{"Favourites", 1}, {"home", 1}, {"trip", 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GooglePhotosAPI{hashCache: NewHashCache("")}
+			opts := UploadOptions{Recursive: true, ForceUpload: true, Metadata: tt.metadata}
+			plan, err := g.PlanUpload(context.Background(), []string{dir}, opts, tt.albumName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, f := range plan.Files {
+				want, ok := tt.want[filepath.Base(f.Path)]
+				if !ok {
+					t.Errorf("unexpected file %s (%s: %s)", f.Path, f.Action, f.Reason)
+					continue
+				}
+				if !slices.Equal(f.Albums, want) {
+					t.Errorf("%s: albums %q, want %q", filepath.Base(f.Path), f.Albums, want)
+				}
+			}
+			// Albums are in walk order, which depends on the file system
+			slices.SortFunc(plan.Albums, func(a, b PlannedAlbum) int { return strings.Compare(a.Name, b.Name) })
+			if !slices.Equal(plan.Albums, tt.albums) {
+				t.Errorf("Albums = %v, want %v", plan.Albums, tt.albums)
+			}
+		})
+	}
+}
+
+// failingTransport fails every request, as when offline
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("network is unreachable")
+}
+
+func TestPlanUploadCheckFails(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("\xFF\xD8\xFF\xE0"+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cacheDir := t.TempDir()
+	g := &GooglePhotosAPI{
+		Api:       &core.Api{Client: &http.Client{Transport: failingTransport{}}},
+		hashCache: NewHashCache(cacheDir),
+	}
+
+	plan, err := g.PlanUpload(context.Background(), []string{dir}, UploadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("PlanUpload() error = %v, want the files marked unknown", err)
+	}
+	for _, f := range plan.Files {
+		if f.Action != PlanUnknown {
+			t.Errorf("%s: %s, want %s", filepath.Base(f.Path), f.Action, PlanUnknown)
+		}
+	}
+	if plan.Summary.Unknown != 2 {
+		t.Errorf("Summary.Unknown = %d, want 2", plan.Summary.Unknown)
+	}
+
+	// A dry run leaves the hash cache as it was
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("cache directory has %d files after a plan, want none", len(entries))
+	}
+}
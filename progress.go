@@ -0,0 +1,48 @@
+package gpm
+
+import (
+	"sync"
+	"time"
+)
+
+// progressInterval is the minimum time between progress events for one file
+const progressInterval = 250 * time.Millisecond
+
+// progressEmitter turns ProgressFunc callbacks into rate-limited progress events.
+// The upload body is read by the HTTP transport's own goroutine, so callbacks may
+// arrive after the request returns; stop makes sure none are sent after that.
+type progressEmitter struct {
+	mu      sync.Mutex
+	last    time.Time
+	sent    bool
+	stopped bool
+	emit    func(done, total int64)
+}
+
+func newProgressEmitter(emit func(done, total int64)) *progressEmitter {
+	return &progressEmitter{last: time.Now(), emit: emit}
+}
+
+// report is a ProgressFunc. The final update of a known total is always sent once
+// progress has been shown, so quick files produce no progress events at all.
+func (p *progressEmitter) report(done, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+	now := time.Now()
+	final := total > 0 && done >= total
+	if now.Sub(p.last) < progressInterval && !(final && p.sent) {
+		return
+	}
+	p.last, p.sent = now, true
+	p.emit(done, total)
+}
+
+// stop discards all later reports
+func (p *progressEmitter) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+}
@@ -0,0 +1,103 @@
+package gpm
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/viperadnan-git/go-gpm/internal/core"
+)
+
+// UploadReader uploads the content of r as a single file named name and returns a
+// channel for status events, like Upload. The upload needs a seekable body and the
+// hash up front, so r is spooled to a temporary file while being hashed; the temp
+// file is removed before the channel closes. Pass size -1 if unknown, otherwise the
+// spooled length is verified against it. A zero modTime uses the current time.
+func (g *GooglePhotosAPI) UploadReader(ctx context.Context, r io.Reader, name string, size int64, modTime time.Time, opts UploadOptions) <-chan UploadEvent {
+	events := make(chan UploadEvent)
+
+	go func() {
+		defer close(events)
+		intake, transfer, cancel := opts.Control.contexts(ctx)
+		defer cancel()
+
+		events <- UploadEvent{Total: 1}
+		events <- UploadEvent{Path: name, Status: StatusHashing, BytesTotal: max(size, 0)}
+
+		progress := newProgressEmitter(func(done, total int64) {
+			events <- UploadEvent{Path: name, Status: StatusHashing, Progress: true, BytesDone: done, BytesTotal: total}
+		})
+		item, err := spoolReader(intake, r, name, size, modTime, opts.TempDir, progress.report)
+		if err != nil {
+			events <- UploadEvent{Path: name, Status: StatusFailed, Error: err}
+			return
+		}
+		defer os.Remove(item.path)
+
+		// The spooled copy is ours, there is nothing on the host to delete
+		opts.DeleteFromHost = false
+		opts.MoveTo = ""
+
+		caption, err := newCaption(opts)
+		if err != nil {
+			events <- UploadEvent{Path: name, Status: StatusFailed, Error: err}
+			return
+		}
+		// A single file needs neither the duplicate tracker nor the concurrency limiter
+		// of Upload: nothing can duplicate it, and its one transfer already waits out
+		// the Retry-After of a throttled attempt before the next
+		run := &uploadRun{gate: g.diskGate(opts), batch: g.scheduler.batch(opts.Priority), control: opts.Control, caption: caption}
+		items := []uploadItem{item}
+		if !opts.ForceUpload {
+			items = g.skipExisting(intake, items, run, opts, events)
+		}
+		for _, item := range items {
+			g.uploadFile(transfer, item, 0, run, opts, events)
+		}
+	}()
+
+	return events
+}
+
+// spoolReader copies r to a temporary file in dir while hashing it
+// The caller removes the returned item's path
+func spoolReader(ctx context.Context, r io.Reader, name string, size int64, modTime time.Time, dir string, progress ProgressFunc) (uploadItem, error) {
+	tmp, err := os.CreateTemp(dir, "gpcli-*"+filepath.Ext(name))
+	if err != nil {
+		return uploadItem{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	hash := sha1.New()
+	cw := &chunkedContextWriter{ctx: ctx, w: io.MultiWriter(tmp, hash), total: max(size, 0), progress: progress}
+	written, err := io.CopyBuffer(cw, r, make([]byte, copyBufferSize))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("expected %d bytes, read %d", size, written)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return uploadItem{}, fmt.Errorf("read error: %w", err)
+	}
+
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	mediaType, _ := resolveMediaType(tmp.Name())
+	sha1Hash := hash.Sum(nil)
+	return uploadItem{
+		path:      tmp.Name(),
+		source:    name,
+		name:      filepath.Base(name),
+		modTime:   modTime,
+		mediaType: mediaType,
+		sha1Hash:  sha1Hash,
+		dedupKey:  core.SHA1ToDedupeKey(sha1Hash),
+		spooled:   true,
+	}, nil
+}
@@ -0,0 +1,83 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestSpoolReader(t *testing.T) {
+	const content = "\xFF\xD8\xFF\xE0jpeg"
+	truncated := func() io.Reader {
+		return io.MultiReader(strings.NewReader(content[:4]), iotest.ErrReader(io.ErrUnexpectedEOF))
+	}
+	tests := []struct {
+		name    string
+		r       func() io.Reader
+		size    int64
+		wantErr bool
+	}{
+		{"known size", func() io.Reader { return strings.NewReader(content) }, int64(len(content)), false},
+		{"unknown size", func() io.Reader { return strings.NewReader(content) }, -1, false},
+		{"shorter than the size", func() io.Reader { return strings.NewReader(content) }, int64(len(content)) + 1, true},
+		{"longer than the size", func() io.Reader { return strings.NewReader(content) }, 2, true},
+		{"read error", truncated, int64(len(content)), true},
+		{"read error with unknown size", truncated, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			item, err := spoolReader(context.Background(), tt.r(), "photo.jpg", tt.size, time.Time{}, dir, nil)
+			entries, _ := os.ReadDir(dir)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				if len(entries) != 0 {
+					t.Errorf("%d temp files left after an error", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("%d temp files, want the spooled copy", len(entries))
+			}
+			data, err := os.ReadFile(item.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != content {
+				t.Errorf("spooled %q, want %q", data, content)
+			}
+			if item.source != "photo.jpg" || item.mediaType != "image/jpeg" || !item.spooled || item.modTime.IsZero() {
+				t.Errorf("item = %+v", item)
+			}
+		})
+	}
+}
+
+func TestUploadReaderReadError(t *testing.T) {
+	dir := t.TempDir()
+	readErr := errors.New("pipe closed")
+	r := io.MultiReader(strings.NewReader("\xFF\xD8"), iotest.ErrReader(readErr))
+
+	var failed *UploadEvent
+	for event := range (&GooglePhotosAPI{}).UploadReader(context.Background(), r, "stdin.jpg", -1, time.Time{}, UploadOptions{TempDir: dir}) {
+		if event.Status == StatusFailed {
+			failed = &event
+		}
+	}
+	if failed == nil || !errors.Is(failed.Error, readErr) {
+		t.Errorf("failed event = %+v, want the read error", failed)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d temp files left after the upload", len(entries))
+	}
+}
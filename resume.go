@@ -0,0 +1,251 @@
+package gpm
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/viperadnan-git/go-gpm/internal/pb"
+)
+
+const (
+	maxResumeAttempts = 3                  // In-process resume attempts after a failed transfer
+	sessionMaxAge     = 7 * 24 * time.Hour // Upload tokens older than this are not reused
+)
+
+// uploadSession is the persisted state of an unfinished upload
+type uploadSession struct {
+	UploadToken string    `json:"uploadToken"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	Offset      int64     `json:"offset"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// uploadSessionStore persists upload sessions as one JSON file per session key,
+// see sessionKey. A store with an empty dir keeps nothing on disk.
+type uploadSessionStore struct {
+	dir    string
+	mu     sync.Mutex
+	locked map[string]bool // Sessions in use in this process
+}
+
+func newUploadSessionStore(cacheDir string) *uploadSessionStore {
+	s := &uploadSessionStore{locked: make(map[string]bool)}
+	if cacheDir != "" {
+		s.dir = filepath.Join(cacheDir, "uploads")
+	}
+	return s
+}
+
+// sessionKey names the session of one file: the same content at two paths, or
+// two files sharing a dedup key, never share an upload
+func sessionKey(dedupKey, path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha1.Sum([]byte(path))
+	return dedupKey + "-" + hex.EncodeToString(sum[:8])
+}
+
+func (s *uploadSessionStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+// lock claims the session for key until unlock is called, reporting false if
+// another transfer, in this process or another, has it. The lock file is left in
+// place while held so a second process can't take the lock on a new file.
+func (s *uploadSessionStore) lock(key string) (unlock func(), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked[key] {
+		return nil, false
+	}
+	var file *os.File
+	if s.dir != "" {
+		if err := os.MkdirAll(s.dir, 0700); err != nil {
+			slog.Warn("failed to create upload session directory", "error", err)
+			return nil, false
+		}
+		lockPath := filepath.Join(s.dir, key+".lock")
+		f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			slog.Warn("failed to open upload session lock", "error", err)
+			return nil, false
+		}
+		// The file may have been removed by its last holder after we opened it
+		opened, err := f.Stat()
+		current, serr := os.Stat(lockPath)
+		if !tryLock(f) || err != nil || serr != nil || !os.SameFile(opened, current) {
+			f.Close()
+			return nil, false
+		}
+		file = f
+	}
+	s.locked[key] = true
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.locked, key)
+		if file != nil {
+			os.Remove(file.Name())
+			file.Close()
+		}
+	}, true
+}
+
+// load returns the stored session for key, or nil if there is none
+func (s *uploadSessionStore) load(key string) *uploadSession {
+	if s.dir == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil
+	}
+	var sess uploadSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		slog.Debug("discarding corrupt upload session", "key", key, "error", err)
+		os.Remove(s.path(key))
+		return nil
+	}
+	return &sess
+}
+
+// save writes the session atomically so an interrupted run never leaves a partial file
+func (s *uploadSessionStore) save(key string, sess *uploadSession) {
+	if s.dir == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess.UpdatedAt = time.Now()
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		slog.Warn("failed to create upload session directory", "error", err)
+		return
+	}
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		slog.Warn("failed to save upload session", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path(key)); err != nil {
+		os.Remove(tmp)
+		slog.Warn("failed to save upload session", "error", err)
+	}
+}
+
+func (s *uploadSessionStore) remove(key string) {
+	if s.dir == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	os.Remove(s.path(key))
+}
+
+// resumeSession looks up the stored session for the file at path and asks the server how
+// far it got. Returns nil if there is nothing usable to resume.
+func (g *GooglePhotosAPI) resumeSession(ctx context.Context, key, path string, size int64) (*uploadSession, int64) {
+	sess := g.sessions.load(key)
+	if sess == nil {
+		return nil, 0
+	}
+	if sess.Path != path || sess.Size != size || time.Since(sess.CreatedAt) > sessionMaxAge {
+		g.sessions.remove(key)
+		return nil, 0
+	}
+
+	offset, final, err := g.QueryUploadOffset(ctx, sess.UploadToken)
+	if err != nil || final || offset > size {
+		// Session expired server-side or finished without a commit we know about
+		slog.Debug("discarding upload session", "key", key, "final", final, "error", err)
+		g.sessions.remove(key)
+		return nil, 0
+	}
+	return sess, offset
+}
+
+// transferFile sends the file body, continuing a previous upload of the same file
+// when one exists and resuming from the server's offset if the connection drops.
+// Sessions belong to source, the path reported in events, so a spooled archive
+// member resumes from a new temp copy. A file whose session is locked by another
+// transfer is sent without one. Reads go through run, which may be nil.
+func (g *GooglePhotosAPI) transferFile(ctx context.Context, filePath, source string, sha1Hash []byte, dedupKey string, size int64, run *uploadRun, progress ProgressFunc) (*pb.CommitToken, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+	body := run.readerAt(ctx, file)
+
+	key := sessionKey(dedupKey, source)
+	unlock, persist := g.sessions.lock(key)
+	if persist {
+		defer unlock()
+	} else {
+		slog.Debug("upload session in use elsewhere, not persisting", "path", source)
+	}
+	save := func(sess *uploadSession) {
+		if persist {
+			g.sessions.save(key, sess)
+		}
+	}
+
+	var sess *uploadSession
+	var offset int64
+	if persist {
+		sess, offset = g.resumeSession(ctx, key, source, size)
+	}
+	if sess != nil {
+		slog.Debug("resuming upload", "path", source, "offset", offset, "size", size)
+	} else {
+		sha1Base64 := base64.StdEncoding.EncodeToString(sha1Hash)
+		token, err := g.GetUploadToken(sha1Base64, size)
+		if err != nil {
+			return nil, fmt.Errorf("upload token error: %w", err)
+		}
+		sess = &uploadSession{UploadToken: token, Path: source, Size: size, CreatedAt: time.Now()}
+		save(sess)
+	}
+
+	for attempt := 1; ; attempt++ {
+		commitToken, err := g.ResumeUploadReader(ctx, body, size, sess.UploadToken, offset, progress)
+		if err == nil {
+			if persist {
+				g.sessions.remove(key)
+			}
+			return commitToken, nil
+		}
+		if ctx.Err() != nil || attempt >= maxResumeAttempts {
+			return nil, fmt.Errorf("upload error: %w", err)
+		}
+
+		newOffset, final, qerr := g.QueryUploadOffset(ctx, sess.UploadToken)
+		if qerr != nil || final {
+			return nil, fmt.Errorf("upload error: %w", err)
+		}
+		offset = newOffset
+		sess.Offset = offset
+		save(sess)
+		slog.Debug("upload interrupted, resuming", "path", source, "offset", offset, "attempt", attempt, "error", err)
+	}
+}
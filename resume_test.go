@@ -0,0 +1,97 @@
+package gpm
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSessionKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		dedupA     string
+		pathA      string
+		dedupB     string
+		pathB      string
+		wantShared bool
+	}{
+		{"same file", "abc", "/photos/a.jpg", "abc", "/photos/a.jpg", true},
+		{"same content elsewhere", "abc", "/photos/a.jpg", "abc", "/backup/a.jpg", false},
+		{"other content at the path", "abc", "/photos/a.jpg", "xyz", "/photos/a.jpg", false},
+		{"archive members", "abc", "backup.zip!/a.jpg", "abc", "backup.zip!/b.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := sessionKey(tt.dedupA, tt.pathA), sessionKey(tt.dedupB, tt.pathB)
+			if (a == b) != tt.wantShared {
+				t.Errorf("sessionKey() = %q and %q, want shared: %v", a, b, tt.wantShared)
+			}
+		})
+	}
+}
+
+func TestUploadSessionStoreLock(t *testing.T) {
+	s := newUploadSessionStore(t.TempDir())
+	key := sessionKey("abc", "/photos/a.jpg")
+
+	unlock, ok := s.lock(key)
+	if !ok {
+		t.Fatal("lock failed on a free session")
+	}
+	if _, ok := s.lock(key); ok {
+		t.Error("second lock succeeded in the same process")
+	}
+	if _, ok := s.lock(sessionKey("abc", "/backup/a.jpg")); !ok {
+		t.Error("lock of another session failed")
+	}
+
+	s.save(key, &uploadSession{UploadToken: "token", Path: "/photos/a.jpg", Size: 10})
+	if sess := s.load(key); sess == nil || sess.UploadToken != "token" {
+		t.Errorf("load() = %+v, want the saved session", sess)
+	}
+
+	unlock()
+	lockPath := filepath.Join(s.dir, key+".lock")
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file left after unlock: %v", err)
+	}
+	unlock, ok = s.lock(key)
+	if !ok {
+		t.Fatal("lock failed after unlock")
+	}
+	unlock()
+
+	// A lock held by another process, through its own open file
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		return
+	}
+	other, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if !tryLock(other) {
+		t.Fatal("tryLock failed on a free file")
+	}
+	if _, ok := s.lock(key); ok {
+		t.Error("lock succeeded while another process holds it")
+	}
+}
+
+func TestUploadSessionStoreInMemory(t *testing.T) {
+	s := newUploadSessionStore("")
+	key := sessionKey("abc", "/photos/a.jpg")
+	unlock, ok := s.lock(key)
+	if !ok {
+		t.Fatal("lock failed")
+	}
+	if _, ok := s.lock(key); ok {
+		t.Error("second lock succeeded")
+	}
+	unlock()
+	s.save(key, &uploadSession{UploadToken: "token"})
+	if sess := s.load(key); sess != nil {
+		t.Errorf("load() = %+v, want nothing kept", sess)
+	}
+}
@@ -0,0 +1,74 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"time"
+
+	"github.com/viperadnan-git/go-gpm/internal/core"
+)
+
+const (
+	defaultRetryDelay = 2 * time.Second // First backoff when UploadOptions.RetryDelay is unset
+	maxRetryDelay     = 2 * time.Minute
+)
+
+// StatusError is returned for API responses with a non-2xx status
+type StatusError = core.StatusError
+
+// RejectedError is returned when the API answered but refused a request or sent an
+// unusable response
+type RejectedError = core.RejectedError
+
+// IsTransientError reports whether a failed upload may succeed if tried again.
+// Rate limiting, server errors and network failures are transient; rejected
+// requests, local file errors and cancellation are not.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.StatusCode
+		return code == 408 || code == 429 || code >= 500
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+	// Anything else failed on the way to or from the server
+	return true
+}
+
+// retryDelay returns the backoff before retry number attempt (starting at 1):
+// base doubled for every earlier attempt, capped, with up to 50% jitter removed
+// so that workers failing together don't retry together.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultRetryDelay
+	}
+	delay := base
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	return delay - rand.N(delay/2+1)
+}
+
+// sleepContext waits for d, returning false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,38 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"testing"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", fmt.Errorf("upload: %w", context.Canceled), false},
+		{"rate limited", &StatusError{StatusCode: 429}, true},
+		{"request timeout", &StatusError{StatusCode: 408}, true},
+		{"server error", fmt.Errorf("commit error: %w", &StatusError{StatusCode: 503}), true},
+		{"bad request", &StatusError{StatusCode: 400}, false},
+		{"forbidden", &StatusError{StatusCode: 403}, false},
+		{"local file", fmt.Errorf("hash: %w", &fs.PathError{Op: "open", Path: "a.jpg", Err: fs.ErrNotExist}), false},
+		{"no media key", fmt.Errorf("commit error: %w", &RejectedError{Msg: "upload rejected by API: no media key returned"}), false},
+		{"bad protobuf", &RejectedError{Msg: "failed to unmarshal protobuf", Err: errors.New("proto: cannot parse invalid wire-format data")}, false},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"connection reset", errors.New("read: connection reset by peer"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransientError(tt.err); got != tt.want {
+				t.Errorf("IsTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
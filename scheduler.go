@@ -0,0 +1,124 @@
+package gpm
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// uploadScheduler shares the client's transfer budget, ApiConfig.UploadWorkers,
+// between the Upload calls running at once. A free slot goes to the waiting batch
+// with the highest priority; among equals, to the one with the fewest transfers
+// running and then the one served longest ago, so a small upload started behind a
+// large one gets going straight away instead of queueing behind it.
+type uploadScheduler struct {
+	budget int // 0 leaves each batch limited only by its own Workers
+
+	mu      sync.Mutex
+	active  int
+	served  uint64 // Grants so far, orders batches that were served less recently
+	waiting []*slotRequest
+}
+
+// slotRequest is a transfer waiting for a slot
+type slotRequest struct {
+	batch   *uploadBatch
+	granted chan struct{} // Closed once the slot is taken for the request
+}
+
+// uploadBatch is one Upload call's share of the scheduler
+type uploadBatch struct {
+	scheduler  *uploadScheduler
+	priority   int
+	active     int    // Slots held, guarded by scheduler.mu
+	lastServed uint64 // Value of scheduler.served at the last grant
+}
+
+func newUploadScheduler(budget int) *uploadScheduler {
+	return &uploadScheduler{budget: max(0, budget)}
+}
+
+// batch registers an upload with the given priority
+func (s *uploadScheduler) batch(priority int) *uploadBatch {
+	return &uploadBatch{scheduler: s, priority: priority}
+}
+
+// acquire waits for a slot, returning false if ctx is cancelled first
+func (b *uploadBatch) acquire(ctx context.Context) bool {
+	s := b.scheduler
+	s.mu.Lock()
+	if s.budget == 0 || (s.active < s.budget && len(s.waiting) == 0) {
+		s.grant(b)
+		s.mu.Unlock()
+		return true
+	}
+	req := &slotRequest{batch: b, granted: make(chan struct{})}
+	s.waiting = append(s.waiting, req)
+	s.mu.Unlock()
+
+	select {
+	case <-req.granted:
+		return true
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.Index(s.waiting, req); i >= 0 {
+		s.waiting = slices.Delete(s.waiting, i, i+1)
+		return false
+	}
+	// Granted while giving up, pass the slot on
+	s.free(b)
+	return false
+}
+
+// release frees a slot taken by acquire
+func (b *uploadBatch) release() {
+	s := b.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.free(b)
+}
+
+func (s *uploadScheduler) grant(b *uploadBatch) {
+	s.active++
+	s.served++
+	b.active++
+	b.lastServed = s.served
+}
+
+// free returns b's slot and hands out whatever slots are available
+func (s *uploadScheduler) free(b *uploadBatch) {
+	s.active--
+	b.active--
+	for len(s.waiting) > 0 && (s.budget == 0 || s.active < s.budget) {
+		i := s.next()
+		req := s.waiting[i]
+		s.waiting = slices.Delete(s.waiting, i, i+1)
+		s.grant(req.batch)
+		close(req.granted)
+	}
+}
+
+// next returns the index of the waiting request to serve next
+func (s *uploadScheduler) next() int {
+	best := 0
+	for i, req := range s.waiting[1:] {
+		if servedBefore(req.batch, s.waiting[best].batch) {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// servedBefore reports whether a should be served ahead of b
+func servedBefore(a, b *uploadBatch) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if a.active != b.active {
+		return a.active < b.active
+	}
+	return a.lastServed < b.lastServed
+}
@@ -0,0 +1,197 @@
+package gpm
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServedBefore(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b uploadBatch
+		want bool
+	}{
+		{"higher priority", uploadBatch{priority: 1, active: 5}, uploadBatch{priority: 0}, true},
+		{"lower priority", uploadBatch{priority: -1}, uploadBatch{priority: 0, active: 5}, false},
+		{"fewer running", uploadBatch{active: 1, lastServed: 9}, uploadBatch{active: 2, lastServed: 1}, true},
+		{"more running", uploadBatch{active: 3}, uploadBatch{active: 2}, false},
+		{"served longer ago", uploadBatch{lastServed: 1}, uploadBatch{lastServed: 2}, true},
+		{"served more recently", uploadBatch{lastServed: 3}, uploadBatch{lastServed: 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := servedBefore(&tt.a, &tt.b); got != tt.want {
+				t.Errorf("servedBefore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// queue starts an acquire for b and waits until it is queued; the label is
+// recorded in order once the slot is granted, and the slot released again
+func queue(t *testing.T, s *uploadScheduler, b *uploadBatch, label string, order *[]string, mu *sync.Mutex, wg *sync.WaitGroup) {
+	t.Helper()
+	s.mu.Lock()
+	before := len(s.waiting)
+	s.mu.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if !b.acquire(context.Background()) {
+			t.Errorf("%s: acquire failed", label)
+			return
+		}
+		mu.Lock()
+		*order = append(*order, label)
+		mu.Unlock()
+		b.release()
+	}()
+	for deadline := time.Now().Add(time.Second); ; {
+		s.mu.Lock()
+		n := len(s.waiting)
+		s.mu.Unlock()
+		if n > before {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never queued", label)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUploadSchedulerOrder(t *testing.T) {
+	type waiter struct {
+		batch string
+		label string
+	}
+	tests := []struct {
+		name     string
+		budget   int
+		priority map[string]int
+		served   []string // Batches that took and returned a slot beforehand, in order
+		holding  []string // Batches holding a slot while the others queue, the first is released for them
+		waiters  []waiter
+		want     []string
+	}{
+		{
+			name:     "priority first",
+			budget:   1,
+			priority: map[string]int{"high": 1},
+			holding:  []string{"low"},
+			waiters:  []waiter{{"low", "low-1"}, {"low", "low-2"}, {"high", "high-1"}},
+			want:     []string{"high-1", "low-1", "low-2"},
+		},
+		{
+			name:    "fewest running first",
+			budget:  2,
+			holding: []string{"big", "big"},
+			waiters: []waiter{{"big", "big-1"}, {"small", "small-1"}},
+			want:    []string{"small-1", "big-1"},
+		},
+		{
+			name:    "served longest ago first",
+			budget:  1,
+			served:  []string{"a", "b"},
+			holding: []string{"c"},
+			waiters: []waiter{{"b", "b-1"}, {"a", "a-1"}},
+			want:    []string{"a-1", "b-1"},
+		},
+		{
+			name:    "small upload behind a large one",
+			budget:  1,
+			holding: []string{"large"},
+			waiters: []waiter{{"large", "large-1"}, {"large", "large-2"}, {"large", "large-3"}, {"small", "small-1"}},
+			want:    []string{"small-1", "large-1", "large-2", "large-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newUploadScheduler(tt.budget)
+			batches := make(map[string]*uploadBatch)
+			batch := func(name string) *uploadBatch {
+				if batches[name] == nil {
+					batches[name] = s.batch(tt.priority[name])
+				}
+				return batches[name]
+			}
+			ctx := context.Background()
+			for _, name := range tt.served {
+				batch(name).acquire(ctx)
+				batch(name).release()
+			}
+			for _, name := range tt.holding {
+				if !batch(name).acquire(ctx) {
+					t.Fatal("acquire failed")
+				}
+			}
+
+			var mu sync.Mutex
+			var order []string
+			var wg sync.WaitGroup
+			for _, w := range tt.waiters {
+				queue(t, s, batch(w.batch), w.label, &order, &mu, &wg)
+			}
+			// Waiters are served one by one from the first released slot
+			batch(tt.holding[0]).release()
+			wg.Wait()
+			for _, name := range tt.holding[1:] {
+				batch(name).release()
+			}
+
+			if !slices.Equal(order, tt.want) {
+				t.Errorf("served %v, want %v", order, tt.want)
+			}
+			if s.active != 0 || len(s.waiting) != 0 {
+				t.Errorf("scheduler left with %d active and %d waiting", s.active, len(s.waiting))
+			}
+		})
+	}
+}
+
+func TestUploadSchedulerUnlimited(t *testing.T) {
+	s := newUploadScheduler(0)
+	b := s.batch(0)
+	for range 100 {
+		if !b.acquire(context.Background()) {
+			t.Fatal("acquire failed without a budget")
+		}
+	}
+}
+
+func TestUploadSchedulerCancel(t *testing.T) {
+	s := newUploadScheduler(1)
+	holder, waiter := s.batch(0), s.batch(0)
+	if !holder.acquire(context.Background()) {
+		t.Fatal("acquire failed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() { done <- waiter.acquire(ctx) }()
+	for {
+		s.mu.Lock()
+		n := len(s.waiting)
+		s.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if <-done {
+		t.Fatal("acquire succeeded after cancel")
+	}
+
+	holder.release()
+	if s.active != 0 || len(s.waiting) != 0 || waiter.active != 0 {
+		t.Errorf("scheduler left with %d active and %d waiting", s.active, len(s.waiting))
+	}
+	if !waiter.acquire(context.Background()) {
+		t.Error("slot not free after the cancelled request")
+	}
+}
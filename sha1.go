@@ -6,8 +6,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/viperadnan-git/go-gpm/internal/core"
 )
 
+// ProgressFunc receives the number of bytes processed so far and the total (0 if unknown)
+type ProgressFunc = core.ProgressFunc
+
 const (
 	contextCheckInterval = 64 * 1024 * 1024 // Check every 64MB
 	copyBufferSize       = 1 * 1024 * 1024  // 1MB copy buffer
@@ -17,6 +22,9 @@ type chunkedContextWriter struct {
 	ctx             context.Context
 	w               io.Writer
 	bytesSinceCheck int64
+	written         int64
+	total           int64
+	progress        ProgressFunc // Optional, called after every write
 }
 
 func (cw *chunkedContextWriter) Write(p []byte) (int, error) {
@@ -32,23 +40,41 @@ func (cw *chunkedContextWriter) Write(p []byte) (int, error) {
 
 	n, err := cw.w.Write(p)
 	cw.bytesSinceCheck += int64(n)
+	cw.written += int64(n)
+	if cw.progress != nil {
+		cw.progress(cw.written, cw.total)
+	}
 	return n, err
 }
 
 func CalculateSHA1(ctx context.Context, filePath string) ([]byte, error) {
+	return CalculateSHA1WithProgress(ctx, filePath, nil)
+}
+
+// CalculateSHA1WithProgress is like CalculateSHA1 and calls progress as the file is read
+func CalculateSHA1WithProgress(ctx context.Context, filePath string, progress ProgressFunc) ([]byte, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
 
+	var total int64
+	if info, err := file.Stat(); err == nil {
+		total = info.Size()
+	}
+
+	return hashReader(ctx, file, total, progress)
+}
+
+// hashReader returns the SHA1 of everything read from r, reporting progress against total
+func hashReader(ctx context.Context, r io.Reader, total int64, progress ProgressFunc) ([]byte, error) {
 	hash := sha1.New()
-	cw := &chunkedContextWriter{ctx: ctx, w: hash}
+	cw := &chunkedContextWriter{ctx: ctx, w: hash, total: total, progress: progress}
 
 	// Use a large buffer (1MB) to reduce syscall overhead
 	buf := make([]byte, copyBufferSize)
-	_, err = io.CopyBuffer(cw, file, buf)
-	if err != nil {
+	if _, err := io.CopyBuffer(cw, r, buf); err != nil {
 		return nil, fmt.Errorf("error calculating hash: %w", err)
 	}
 
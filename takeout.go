@@ -0,0 +1,336 @@
+package gpm
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	takeoutAlbumFile = "metadata.json" // Holds the title of a Takeout album folder
+
+	// takeoutNameLimit is about the length Takeout cuts sidecar names to, ".json"
+	// included; exports differ by a few characters, so it errs on the short side
+	takeoutNameLimit = 46
+
+	takeoutSidecarLimit = 1 << 20 // Sidecars are a few KB, anything larger isn't one
+)
+
+var (
+	// takeoutCounter matches the "(1)" Takeout appends to tell apart files of the same name
+	takeoutCounter = regexp.MustCompile(`^(.*)(\(\d+\))$`)
+	// takeoutYearFolder matches the folders that hold all photos of a year, not an album
+	takeoutYearFolder = regexp.MustCompile(`^Photos from \d{4}$`)
+)
+
+// TakeoutMetadata is the part of a Google Takeout JSON sidecar that is restored on import
+type TakeoutMetadata struct {
+	Title       string
+	Description string
+	TakenTime   time.Time // photoTakenTime, or creationTime if there is none; zero if absent
+	Favorited   bool
+	Archived    bool
+}
+
+// TakeoutItem is a media file found in a Takeout export
+type TakeoutItem struct {
+	Path     string
+	Sidecar  string           // Path of the JSON sidecar, empty if none was found
+	Metadata *TakeoutMetadata // nil without a sidecar
+	Album    string           // Album the file was exported under, empty for year folders
+}
+
+// takeoutTimestamp is how Takeout stores times: seconds since the epoch as a string
+type takeoutTimestamp struct {
+	Timestamp string `json:"timestamp"`
+}
+
+func (t *takeoutTimestamp) time() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(t.Timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// ReadTakeoutMetadata parses a Takeout JSON sidecar
+func ReadTakeoutMetadata(path string) (*TakeoutMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseTakeoutMetadata(path, data)
+}
+
+func parseTakeoutMetadata(path string, data []byte) (*TakeoutMetadata, error) {
+	var raw struct {
+		Title          string            `json:"title"`
+		Description    string            `json:"description"`
+		PhotoTakenTime *takeoutTimestamp `json:"photoTakenTime"`
+		CreationTime   *takeoutTimestamp `json:"creationTime"`
+		Favorited      bool              `json:"favorited"`
+		Archived       bool              `json:"archived"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid sidecar %s: %w", path, err)
+	}
+	meta := &TakeoutMetadata{
+		Title:       raw.Title,
+		Description: strings.TrimSpace(raw.Description),
+		TakenTime:   raw.PhotoTakenTime.time(),
+		Favorited:   raw.Favorited,
+		Archived:    raw.Archived,
+	}
+	if meta.TakenTime.IsZero() {
+		meta.TakenTime = raw.CreationTime.time()
+	}
+	return meta, nil
+}
+
+// ScanTakeout finds the media files of an extracted Takeout export under root,
+// pairs each with its JSON sidecar and works out the album it was exported under.
+// Media are found like Upload finds them, by content, and honour .gpcliignore
+// files. Paths that can't be read are passed to onError, if set, and skipped.
+// Files whose sidecar can't be read are returned without metadata.
+func ScanTakeout(root string, onError func(path string, err error)) []TakeoutItem {
+	if onError == nil {
+		onError = func(string, error) {}
+	}
+	filter, _ := newPathFilter(UploadOptions{})
+
+	// Subdirectories are walked as they are reached, so a folder's files come in
+	// several runs; they are gathered first
+	type folder struct{ media, sidecars []string }
+	folders := make(map[string]*folder)
+	w := &walker{recursive: true, visited: make(map[string]bool)}
+	w.walk([]string{root}, func(file walkedFile) bool {
+		dir, name := filepath.Split(file.path)
+		dir = filepath.Clean(dir)
+		f := folders[dir]
+		if f == nil {
+			f = &folder{}
+			folders[dir] = f
+		}
+		switch {
+		case strings.EqualFold(filepath.Ext(name), ".json"):
+			if name != takeoutAlbumFile {
+				f.sidecars = append(f.sidecars, name)
+			}
+		case filter.accepts(file.root, file.path):
+			f.media = append(f.media, name)
+		}
+		return true
+	}, onError)
+
+	var items []TakeoutItem
+	for _, dir := range slices.Sorted(maps.Keys(folders)) {
+		f := folders[dir]
+		if len(f.media) == 0 {
+			continue
+		}
+		album := takeoutAlbum(root, dir)
+		sidecars := newTakeoutSidecars(f.sidecars)
+		for _, name := range f.media {
+			item := TakeoutItem{Path: filepath.Join(dir, name), Album: album}
+			if sidecar := matchTakeoutSidecar(name, sidecars); sidecar != "" {
+				item.Sidecar = filepath.Join(dir, sidecar)
+				item.Metadata, _ = ReadTakeoutMetadata(item.Sidecar)
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// takeoutAlbum returns the album a Takeout folder stands for: the title in its
+// metadata.json, else the folder name. Year folders and root aren't albums.
+func takeoutAlbum(root, dir string) string {
+	data, _ := os.ReadFile(filepath.Join(dir, takeoutAlbumFile))
+	return takeoutAlbumName(filepath.Base(dir), filepath.Clean(dir) == filepath.Clean(root), data)
+}
+
+// takeoutAlbumName is takeoutAlbum for a folder called name, given the content of
+// its metadata.json, nil if it has none
+func takeoutAlbumName(name string, isRoot bool, metadata []byte) string {
+	if metadata != nil {
+		var meta struct {
+			Title string `json:"title"`
+		}
+		if json.Unmarshal(metadata, &meta) == nil && meta.Title != "" {
+			return meta.Title
+		}
+	}
+	if isRoot || name == "Google Photos" || takeoutYearFolder.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// takeoutZipFolder is a folder of a zipped Takeout export, possibly spread over
+// several parts
+type takeoutZipFolder struct {
+	media    []takeoutZipFile
+	sidecars map[string]takeoutZipFile // By base name
+	album    *takeoutZipFile           // metadata.json, nil if there is none
+}
+
+type takeoutZipFile struct {
+	archive string
+	file    *zip.File
+}
+
+// path returns the path of the member in events, see ArchiveSeparator
+func (f takeoutZipFile) path() string {
+	return f.archive + ArchiveSeparator + memberName(f.file.Name)
+}
+
+func (f takeoutZipFile) read() ([]byte, error) {
+	r, err := f.file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, takeoutSidecarLimit))
+}
+
+// ScanTakeoutArchives is ScanTakeout for the zip files of an export, read from
+// their index without extracting them. The parts of a multi-part export are
+// scanned together, so sidecars and album metadata find their media whichever part
+// they are in. Paths name archive members, which Upload reads in place.
+func ScanTakeoutArchives(archives []string) ([]TakeoutItem, error) {
+	folders := make(map[string]*takeoutZipFolder)
+	for _, archive := range archives {
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", archive, err)
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			dir, name := path.Split(memberName(f.Name))
+			folder := folders[dir]
+			if folder == nil {
+				folder = &takeoutZipFolder{sidecars: make(map[string]takeoutZipFile)}
+				folders[dir] = folder
+			}
+			file := takeoutZipFile{archive: archive, file: f}
+			switch {
+			case name == takeoutAlbumFile:
+				folder.album = &file
+			case strings.EqualFold(path.Ext(name), ".json"):
+				folder.sidecars[name] = file
+			case isSupportedByGooglePhotos(name):
+				folder.media = append(folder.media, file)
+			}
+		}
+	}
+
+	var items []TakeoutItem
+	for _, dir := range slices.Sorted(maps.Keys(folders)) {
+		folder := folders[dir]
+		if len(folder.media) == 0 {
+			continue
+		}
+		var metadata []byte
+		if folder.album != nil {
+			metadata, _ = folder.album.read()
+		}
+		album := takeoutAlbumName(path.Base(dir), dir == "", metadata)
+		sidecars := newTakeoutSidecars(slices.Collect(maps.Keys(folder.sidecars)))
+		for _, media := range folder.media {
+			item := TakeoutItem{Path: media.path(), Album: album}
+			if name := matchTakeoutSidecar(path.Base(media.file.Name), sidecars); name != "" {
+				sidecar := folder.sidecars[name]
+				item.Sidecar = sidecar.path()
+				if data, err := sidecar.read(); err == nil {
+					item.Metadata, _ = parseTakeoutMetadata(item.Sidecar, data)
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// takeoutSidecars indexes the JSON files of a folder by their name without the
+// extension and counter, each list in name order
+type takeoutSidecars map[string][]takeoutSidecar
+
+type takeoutSidecar struct {
+	name    string
+	counter string // "(1)" of duplicates, empty for others
+}
+
+func newTakeoutSidecars(names []string) takeoutSidecars {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	sidecars := make(takeoutSidecars, len(sorted))
+	for _, name := range sorted {
+		body := strings.TrimSuffix(name, filepath.Ext(name))
+		counter := ""
+		if m := takeoutCounter.FindStringSubmatch(body); m != nil {
+			body, counter = m[1], m[2]
+		}
+		sidecars[body] = append(sidecars[body], takeoutSidecar{name: name, counter: counter})
+	}
+	return sidecars
+}
+
+// matchTakeoutSidecar picks the sidecar of a media file from the JSON files next to
+// it. Takeout names sidecars "IMG_1234.jpg.json" or, in newer exports,
+// "IMG_1234.jpg.supplemental-metadata.json", but cuts long names short
+// ("a_very_long_name.jp.json", "IMG_1234.jpg.supplemen.json"), moves the counter
+// of duplicates to the end ("IMG_1234(1).jpg" has "IMG_1234.jpg(1).json", or
+// "a_very_long_name.jp(1).json" once cut) and gives edited copies no sidecar of
+// their own ("IMG_1234-edited.jpg" uses the original's).
+func matchTakeoutSidecar(mediaName string, sidecars takeoutSidecars) string {
+	ext := filepath.Ext(mediaName)
+	stem := strings.TrimSuffix(mediaName, ext)
+
+	// Name variants to look for, most specific first
+	type variant struct{ stem, counter string }
+	variants := []variant{{stem, ""}}
+	if m := takeoutCounter.FindStringSubmatch(stem); m != nil {
+		variants = []variant{{m[1], m[2]}, {stem, ""}}
+	}
+	for _, v := range variants {
+		if edited := strings.TrimSuffix(v.stem, "-edited"); edited != v.stem {
+			variants = append(variants, variant{edited, v.counter})
+		}
+	}
+
+	for _, v := range variants {
+		// A sidecar name is the full name cut somewhere, the longest match wins
+		full := v.stem + ext + ".supplemental-metadata"
+		for n := len(full); n > 0; n-- {
+			for _, sidecar := range sidecars[full[:n]] {
+				if sidecar.counter != v.counter {
+					continue
+				}
+				// Exact names and names cut past the stem match; long names may
+				// also be cut within the stem itself
+				if n >= len(v.stem) || len(sidecar.name)-len(sidecar.counter) >= takeoutNameLimit {
+					return sidecar.name
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,235 @@
+package gpm
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchTakeoutSidecar(t *testing.T) {
+	const long = "a_very_long_name_exported_from_a_camera_app"
+	const longer = "an_even_longer_name_that_gets_cut_inside_the_stem"
+
+	tests := []struct {
+		media    string
+		sidecars []string
+		want     string
+	}{
+		{"IMG_1234.jpg", []string{"IMG_1234.jpg.json"}, "IMG_1234.jpg.json"},
+		{"IMG_1234.jpg", []string{"IMG_1234.jpg.supplemental-metadata.json"}, "IMG_1234.jpg.supplemental-metadata.json"},
+		{"IMG_1234.jpg", []string{"IMG_1234.jpg.supplemen.json"}, "IMG_1234.jpg.supplemen.json"},
+		{"IMG_1234.JPG", []string{"IMG_1234.JPG.JSON"}, "IMG_1234.JPG.JSON"},
+		{"IMG_1234.jpg", []string{"IMG_1234.json"}, "IMG_1234.json"},
+		{"IMG_1234.jpg", []string{"IMG_1234.jpg.json", "IMG_1234.jpg.supplemental-metadata.json"}, "IMG_1234.jpg.supplemental-metadata.json"},
+
+		// Duplicates carry the counter at the end of the sidecar name
+		{"IMG_1234(1).jpg", []string{"IMG_1234.jpg.json", "IMG_1234.jpg(1).json"}, "IMG_1234.jpg(1).json"},
+		{"IMG_1234.jpg", []string{"IMG_1234.jpg(1).json", "IMG_1234.jpg.json"}, "IMG_1234.jpg.json"},
+		{"IMG_1234(2).jpg", []string{"IMG_1234.jpg.json", "IMG_1234.jpg(1).json"}, ""},
+		{"IMG_1234(1).jpg", []string{"IMG_1234(1).jpg.json"}, "IMG_1234(1).jpg.json"},
+
+		// Edited copies use the original's sidecar
+		{"IMG_1234-edited.jpg", []string{"IMG_1234.jpg.json"}, "IMG_1234.jpg.json"},
+		{"IMG_1234-edited(1).jpg", []string{"IMG_1234.jpg.json", "IMG_1234.jpg(1).json"}, "IMG_1234.jpg(1).json"},
+		{"IMG_1234-edited.jpg", []string{"IMG_1234-edited.jpg.json", "IMG_1234.jpg.json"}, "IMG_1234-edited.jpg.json"},
+
+		// Long names are cut short, within the extension or the stem
+		{long + ".jpg", []string{long + ".jp.json"}, long + ".jp.json"},
+		{long + "(1).jpg", []string{long + ".jp.json", long + ".jp(1).json"}, long + ".jp(1).json"},
+		{long + "-edited.jpg", []string{long + ".jp.json"}, long + ".jp.json"},
+		{longer + ".jpg", []string{"an_even_longer_name_that_gets_cut_inside_.json"}, "an_even_longer_name_that_gets_cut_inside_.json"},
+
+		// Short prefixes of other files never match
+		{"IMG_12.jpg", []string{"IMG_1.json", "IMG_123.jpg.json"}, ""},
+		{"other.jpg", []string{"IMG_1234.jpg.json"}, ""},
+		{"IMG_1234.jpg", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.media, func(t *testing.T) {
+			if got := matchTakeoutSidecar(tt.media, newTakeoutSidecars(tt.sidecars)); got != tt.want {
+				t.Errorf("matchTakeoutSidecar(%q, %q) = %q, want %q", tt.media, tt.sidecars, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanTakeout(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Takeout", "Google Photos")
+	write := func(rel, content string) {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const jpeg = "\xFF\xD8\xFF\xE0jpeg"
+	write("Photos from 2021/IMG_0001.jpg", jpeg)
+	write("Photos from 2021/IMG_0001.jpg.json", `{"title":"IMG_0001.jpg","description":" Beach ","photoTakenTime":{"timestamp":"1625000000"},"favorited":true}`)
+	write("Photos from 2021/IMG_0002.jpg", jpeg)
+	write("Photos from 2021/IMG_0002.jpg.json", `{"creationTime":{"timestamp":"1625000100"},"archived":true}`)
+	write("Photos from 2021/IMG_0003.jpg", jpeg)
+	write("Photos from 2021/notes.txt", "text")
+	write("Photos from 2021/saved.jpg", "<html>not a photo</html>") // Found by content, not name
+	write("Trip/metadata.json", `{"title":"Summer Trip"}`)
+	write("Trip/IMG_0001.jpg", jpeg)
+	write("Trip/IMG_0001.jpg.json", `not json`)
+	write("Unnamed/clip.mp4", "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")
+
+	items := ScanTakeout(root, func(path string, err error) { t.Errorf("%s: %v", path, err) })
+	byPath := make(map[string]TakeoutItem)
+	for _, item := range items {
+		rel, _ := filepath.Rel(root, item.Path)
+		byPath[filepath.ToSlash(rel)] = item
+	}
+
+	tests := []struct {
+		path        string
+		album       string
+		sidecar     bool
+		description string
+		taken       time.Time
+		favorited   bool
+		archived    bool
+	}{
+		{"Photos from 2021/IMG_0001.jpg", "", true, "Beach", time.Unix(1625000000, 0), true, false},
+		{"Photos from 2021/IMG_0002.jpg", "", true, "", time.Unix(1625000100, 0), false, true},
+		{"Photos from 2021/IMG_0003.jpg", "", false, "", time.Time{}, false, false},
+		{"Trip/IMG_0001.jpg", "Summer Trip", true, "", time.Time{}, false, false},
+		{"Unnamed/clip.mp4", "Unnamed", false, "", time.Time{}, false, false},
+	}
+	if len(items) != len(tests) {
+		t.Errorf("ScanTakeout found %d items, want %d", len(items), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			item, ok := byPath[tt.path]
+			if !ok {
+				t.Fatal("not found")
+			}
+			if item.Album != tt.album {
+				t.Errorf("Album = %q, want %q", item.Album, tt.album)
+			}
+			if (item.Sidecar != "") != tt.sidecar {
+				t.Errorf("Sidecar = %q, want one: %v", item.Sidecar, tt.sidecar)
+			}
+			if item.Metadata == nil {
+				if !tt.taken.IsZero() {
+					t.Fatal("Metadata is nil")
+				}
+				return
+			}
+			m := item.Metadata
+			if m.Description != tt.description || !m.TakenTime.Equal(tt.taken) || m.Favorited != tt.favorited || m.Archived != tt.archived {
+				t.Errorf("Metadata = %+v", *m)
+			}
+		})
+	}
+}
+
+func TestScanTakeoutUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions don't apply to root")
+	}
+	root := t.TempDir()
+	for _, dir := range []string{"Locked", "Trip"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "IMG_0001.jpg"), []byte("\xFF\xD8\xFF\xE0jpeg"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	locked := filepath.Join(root, "Locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	var failed []string
+	items := ScanTakeout(root, func(path string, err error) { failed = append(failed, path) })
+	if len(failed) != 1 || failed[0] != locked {
+		t.Errorf("errors for %v, want %s", failed, locked)
+	}
+	if len(items) != 1 || items[0].Album != "Trip" {
+		t.Errorf("items = %+v, want Trip/IMG_0001.jpg", items)
+	}
+}
+
+func TestScanTakeoutArchives(t *testing.T) {
+	dir := t.TempDir()
+	writeZip := func(name string, files map[string]string) string {
+		path := filepath.Join(dir, name)
+		out, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := zip.NewWriter(out)
+		for name, content := range files {
+			f, err := w.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write([]byte(content))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		out.Close()
+		return path
+	}
+	// Sidecars and album metadata in one part, their media in the other
+	part1 := writeZip("takeout-001.zip", map[string]string{
+		"Takeout/Google Photos/Photos from 2021/IMG_0001.jpg": "jpeg",
+		"Takeout/Google Photos/Trip/metadata.json":            `{"title":"Summer Trip"}`,
+		"Takeout/Google Photos/Trip/IMG_0002.jpg.json":        `{"photoTakenTime":{"timestamp":"1625000100"}}`,
+		"Takeout/archive_browser.html":                        "html",
+	})
+	part2 := writeZip("takeout-002.zip", map[string]string{
+		"Takeout/Google Photos/Photos from 2021/IMG_0001.jpg.json": `{"photoTakenTime":{"timestamp":"1625000000"},"favorited":true}`,
+		"Takeout/Google Photos/Trip/IMG_0002.jpg":                  "jpeg",
+		"./Takeout/Google Photos/Unnamed/clip.mp4":                 "video",
+	})
+
+	items, err := ScanTakeoutArchives([]string{part1, part2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member := func(archive, name string) string { return archive + ArchiveSeparator + "Takeout/Google Photos/" + name }
+	tests := []struct {
+		path    string
+		album   string
+		sidecar string
+		taken   time.Time
+	}{
+		{member(part1, "Photos from 2021/IMG_0001.jpg"), "", member(part2, "Photos from 2021/IMG_0001.jpg.json"), time.Unix(1625000000, 0)},
+		{member(part2, "Trip/IMG_0002.jpg"), "Summer Trip", member(part1, "Trip/IMG_0002.jpg.json"), time.Unix(1625000100, 0)},
+		{member(part2, "Unnamed/clip.mp4"), "Unnamed", "", time.Time{}},
+	}
+	if len(items) != len(tests) {
+		t.Fatalf("ScanTakeoutArchives found %d items, want %d: %+v", len(items), len(tests), items)
+	}
+	for i, tt := range tests {
+		item := items[i]
+		if item.Path != tt.path || item.Album != tt.album || item.Sidecar != tt.sidecar {
+			t.Errorf("item %d = %q in %q with %q, want %q in %q with %q", i, item.Path, item.Album, item.Sidecar, tt.path, tt.album, tt.sidecar)
+		}
+		if tt.taken.IsZero() {
+			if item.Metadata != nil {
+				t.Errorf("item %d has metadata %+v", i, *item.Metadata)
+			}
+		} else if item.Metadata == nil || !item.Metadata.TakenTime.Equal(tt.taken) {
+			t.Errorf("item %d metadata = %+v, want taken at %v", i, item.Metadata, tt.taken)
+		}
+	}
+	if m := items[0].Metadata; m != nil && !m.Favorited {
+		t.Error("favorited flag lost")
+	}
+
+	if _, err := ScanTakeoutArchives([]string{filepath.Join(dir, "missing.zip")}); err == nil {
+		t.Error("no error for a missing archive")
+	}
+}
@@ -1,8 +1,9 @@
 package gpm
 
 import (
+	"cmp"
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/viperadnan-git/go-gpm/internal/core"
 )
@@ -25,183 +27,786 @@ const (
 	StatusCompleted  UploadStatus = "completed"
 	StatusSkipped    UploadStatus = "skipped" // Already in library
 	StatusFailed     UploadStatus = "failed"
+	StatusRetrying   UploadStatus = "retrying" // Transient failure, the file is tried again after a backoff
+
+	// Host removal, sent before the completed or skipped event of the same file
+	StatusVerifying UploadStatus = "verifying" // Confirming the library holds the file
+	StatusDeleted   UploadStatus = "deleted"   // Local file removed
+	StatusMoved     UploadStatus = "moved"     // Local file moved to UploadOptions.MoveTo
+	StatusKept      UploadStatus = "kept"      // Local file left in place, Error says why
 )
 
 // UploadEvent represents a status update for a file upload
 type UploadEvent struct {
-	Path     string
-	Status   UploadStatus
-	MediaKey string
-	DedupKey string
-	Error    error
-	WorkerID int
-	Total    int // Total files in batch (set on first event)
+	Path        string
+	Status      UploadStatus
+	MediaType   string // Detected MIME type, empty if unknown
+	MediaKey    string
+	DedupKey    string
+	Error       error
+	WorkerID    int
+	Total       int      // Total files in batch, sent once the directory walk has finished
+	Discovered  int      // Files found so far, sent periodically while the walk is running
+	MovedTo     string   // Destination of a StatusMoved file
+	Attempt     int      // Number of the failed attempt, set on StatusRetrying
+	Concurrency int      // Transfers allowed at once, sent at the start and whenever throttling changes it
+	Albums      []string // Albums from FileMetadata, set on completed and skipped events
+
+	// A Live Photo is reported as one event for its still. The video half gets
+	// intermediate events of its own but its result is part of the still's.
+	LiveVideo         string // Video half of a Live Photo still, see UploadOptions.LivePhotos
+	LiveVideoMediaKey string // Media key of the video half, empty unless it is in the library
+
+	DuplicateOf string          // Identical file of the same upload whose media key a skipped file got
+	Duplicates  *DuplicateGroup // Identical files, sent once per group at the end with ReportDuplicates
+
+	// Byte progress while hashing or uploading. Progress events repeat the current
+	// Status instead of announcing a new one and are sent at most every 250ms per file.
+	// BytesTotal is also set on the hashing and uploading transitions.
+	Progress   bool
+	BytesDone  int64
+	BytesTotal int64 // File size, 0 if unknown
 }
 
+const (
+	hashCheckBatchSize     = 500             // Hashes sent to FindRemoteMediaByHashes at a time
+	hashCheckFlushInterval = 1 * time.Second // Longest a partial batch waits for more hashes
+)
+
 // UploadOptions contains runtime options for upload operations
 type UploadOptions struct {
-	Workers         int
+	Workers         int  // Files transferred at once
+	HashWorkers     int  // Files hashed at once, defaults to Workers (1 with SerialDiskReads)
+	CheckWorkers    int  // Existence check batches in flight at once, defaults to 1
+	QueueSize       int  // Capacity of the queues between pipeline stages, defaults to Workers
+	SerialDiskReads bool // HDD mode: one disk read at a time, in large sequential chunks
 	Recursive       bool
 	ForceUpload     bool
-	DeleteFromHost  bool
+	DeleteFromHost  bool   // Remove local files once the library is confirmed to hold them
+	MoveTo          string // Move local files into this directory instead of deleting them
+	VerifyDownload  bool   // Before removal, also download each item and compare its SHA1
 	DisableFilter   bool
-	Caption         string
+	Include         []string // Gitignore-style patterns, if set only matching files are uploaded
+	Exclude         []string // Gitignore-style patterns for files and directories to skip
+	FollowSymlinks  bool     // Descend into linked directories and upload linked files
+	Archives        bool     // Upload the members of zip and tar archives found in directories, see ArchiveSeparator
+	TempDir         string   // Where archive members are spooled, defaults to the system temp directory
+	Caption         string   // Caption template evaluated per file, see CaptionTemplate
 	ShouldFavourite bool
 	ShouldArchive   bool
 	Quality         string // "original" or "storage-saver"
 	UseQuota        bool
+	TimestampSource TimestampSource // Date given to uploaded items, empty means TimestampMtime
+	Retries         int             // Extra attempts per file after transient errors, see IsTransientError
+	RetryDelay      time.Duration   // Backoff before the first retry, doubled for each one after (default 2s)
+	Control         *UploadControl  // Pauses, resumes or stops the upload from another goroutine, may be nil
+	Priority        int             // Uploads with higher priority get free slots of ApiConfig.UploadWorkers first
+
+	// Metadata returns per-file metadata, such as from sidecar files, given the path
+	// reported in events. It's called on the transfer workers and may return nil.
+	Metadata func(path string) *FileMetadata
+
+	// XMP applies the XMP sidecar and embedded XMP of each file, nil ignores XMP
+	XMP *XMPMapping
+
+	// LivePhotos pairs Live Photo stills with their videos and uploads each pair
+	// together, nil uploads them as unrelated files
+	LivePhotos *LivePhotoOptions
+
+	// ReportDuplicates sends an event for each group of identical files once the
+	// upload finishes, which means remembering every path seen. Only one file of a
+	// group is uploaded either way.
+	ReportDuplicates bool
+
+	// rootOf gives the upload root of a file passed explicitly, its own directory
+	// if nil. Watch sets it so settled files keep the root they were found under.
+	rootOf func(path string) string
+}
+
+// FileMetadata overrides UploadOptions for a single file
+type FileMetadata struct {
+	Timestamp time.Time // Date to commit, zero leaves it to TimestampSource
+	Caption   string    // Used instead of the caption template when set
+	Favourite bool      // Favourite the item even without ShouldFavourite
+	Archive   bool      // Archive the item even without ShouldArchive
+	Albums    []string  // Albums the caller should add the item to, reported in UploadEvent.Albums
+}
+
+// metadataFor returns the metadata of item from the Metadata hook and XMP, never nil
+// XMP is read in a turn of gate.
+func (o UploadOptions) metadataFor(item uploadItem, gate *diskGate) *FileMetadata {
+	return o.fileMetadata(item.source, item.path, gate)
+}
+
+// fileMetadata is metadataFor the file reported as source, with its XMP read from
+// path; an empty path skips XMP
+func (o UploadOptions) fileMetadata(source, path string, gate *diskGate) *FileMetadata {
+	meta := &FileMetadata{}
+	if o.Metadata != nil {
+		if m := o.Metadata(source); m != nil {
+			copied := *m
+			copied.Albums = slices.Clone(m.Albums)
+			meta = &copied
+		}
+	}
+	if o.XMP != nil && path != "" {
+		var xmp *XMPMetadata
+		var err error
+		gate.do(func() { xmp, err = ReadXMP(path) })
+		if err != nil {
+			slog.Warn("failed to read XMP", "path", source, "error", err)
+		} else {
+			o.XMP.apply(xmp, meta)
+		}
+	}
+	return meta
+}
+
+func (o UploadOptions) transferWorkers() int {
+	return max(1, o.Workers)
+}
+
+func (o UploadOptions) hashWorkers() int {
+	if o.HashWorkers > 0 {
+		return o.HashWorkers
+	}
+	if o.SerialDiskReads {
+		return 1
+	}
+	return o.transferWorkers()
+}
+
+func (o UploadOptions) checkWorkers() int {
+	return max(1, o.CheckWorkers)
+}
+
+func (o UploadOptions) queueSize() int {
+	if o.QueueSize > 0 {
+		return o.QueueSize
+	}
+	return o.transferWorkers()
 }
 
 // Upload uploads files to Google Photos and returns a channel for status events.
-// The channel is closed when upload completes. Multiple calls are queued automatically.
+// Files are hashed and checked against the library in batches while the directory
+// walk is still running, so transfers start early and memory stays bounded. Each
+// stage has its own pool of workers, sized by UploadOptions, so hashing a large file
+// never holds up a network slot or the other way round. Identical files are
+// uploaded once, the other copies are reported as skipped with its media key.
+// The channel is closed when upload completes. Several uploads may run at once; they
+// share ApiConfig.UploadWorkers, if set, by priority and then fairly.
+// Cancelling ctx aborts at once; UploadOptions.Control can also pause the upload or
+// stop it after the files being transferred have finished.
 func (g *GooglePhotosAPI) Upload(ctx context.Context, paths []string, opts UploadOptions) <-chan UploadEvent {
 	events := make(chan UploadEvent)
 
 	go func() {
-		// Serialize upload batches
-		g.uploadMu.Lock()
-		defer g.uploadMu.Unlock()
 		defer close(events)
+		defer func() {
+			if err := g.hashCache.Save(); err != nil {
+				slog.Warn("failed to save hash cache", "error", err)
+			}
+		}()
 
-		// Filter files
-		files, err := filterGooglePhotosFiles(paths, opts.Recursive, opts.DisableFilter)
+		filter, err := newPathFilter(opts)
 		if err != nil {
 			events <- UploadEvent{Status: StatusFailed, Error: err}
 			return
 		}
-		if len(files) == 0 {
+		caption, err := newCaption(opts)
+		if err != nil {
+			events <- UploadEvent{Status: StatusFailed, Error: err}
+			return
+		}
+		videoCaption, err := newVideoCaption(opts)
+		if err != nil {
+			events <- UploadEvent{Status: StatusFailed, Error: err}
 			return
 		}
+		// A graceful stop ends intake, which stops new files from being read or
+		// started, while transfer lets the files already being sent finish
+		intake, transfer, cancel := opts.Control.contexts(ctx)
+		defer cancel()
+
+		// Archive members are spooled to temp files, which are removed as each one is
+		// done; the directory catches those dropped from the queues by a cancel
+		var spoolDir string
+		if opts.Archives || slices.ContainsFunc(paths, isArchive) || slices.ContainsFunc(paths, isArchiveMember) {
+			if spoolDir, err = os.MkdirTemp(opts.TempDir, "gpcli-spool-*"); err != nil {
+				events <- UploadEvent{Status: StatusFailed, Error: fmt.Errorf("failed to create temp directory: %w", err)}
+				return
+			}
+			defer os.RemoveAll(spoolDir)
+		}
+
+		// Transfers back off when the server throttles, see concurrencyLimiter
+		limiter := newConcurrencyLimiter(opts.transferWorkers())
+		run := &uploadRun{
+			gate:         g.diskGate(opts),
+			limiter:      limiter,
+			batch:        g.scheduler.batch(opts.Priority),
+			control:      opts.Control,
+			caption:      caption,
+			videoCaption: videoCaption,
+			liveVideo:    opts.LivePhotos.video(),
+			spoolDir:     spoolDir,
+			duplicates:   newDuplicateTracker(opts.ReportDuplicates),
+		}
+		events <- UploadEvent{Concurrency: limiter.current()}
+		stopReporting := make(chan struct{})
+		var reporter sync.WaitGroup
+		reporter.Add(1)
+		go func() {
+			defer reporter.Done()
+			for {
+				select {
+				case n := <-limiter.updates:
+					events <- UploadEvent{Concurrency: n}
+				case <-stopReporting:
+					return
+				}
+			}
+		}()
+		defer reporter.Wait()
+		defer close(stopReporting)
+
+		// walk -> hash -> check -> upload, each stage connected by a bounded queue
+		files := make(chan walkedFile, opts.queueSize())
+		hashed := make(chan uploadItem, opts.queueSize())
+		pending := make(chan uploadItem, opts.queueSize())
+		var stages sync.WaitGroup
+
+		stages.Add(3)
+		go func() {
+			defer stages.Done()
+			defer close(files)
+			g.walkFiles(intake, paths, filter, opts, files, events)
+		}()
+		go func() {
+			defer stages.Done()
+			defer close(hashed)
+			runWorkers(intake, files, opts.hashWorkers(), func(workerID int, file walkedFile) {
+				item, ok := g.hashItem(intake, file, workerID, run, events)
+				if !ok || !run.duplicates.claim(&item) {
+					return
+				}
+				select {
+				case hashed <- item:
+				case <-intake.Done():
+				}
+			})
+		}()
+		go func() {
+			defer stages.Done()
+			defer close(pending)
+			var checkers sync.WaitGroup
+			for range opts.checkWorkers() {
+				checkers.Add(1)
+				go func() {
+					defer checkers.Done()
+					g.checkItems(intake, hashed, pending, run, opts, events)
+				}()
+			}
+			checkers.Wait()
+		}()
+
+		runWorkers(intake, pending, opts.transferWorkers(), func(workerID int, item uploadItem) {
+			g.uploadFile(transfer, item, workerID, run, opts, events)
+		})
+		stages.Wait()
+
+		if opts.ReportDuplicates {
+			for _, group := range run.duplicates.groups() {
+				events <- UploadEvent{Duplicates: &group}
+			}
+		}
+	}()
+
+	return events
+}
+
+// uploadItem is a file that has been hashed and is waiting to be checked or uploaded
+type uploadItem struct {
+	path      string // Local file to read
+	source    string // Path reported in events (usually the same as path)
+	root      string // Upload root path was found under, for MoveTo
+	name      string // File name to commit (defaults to the base name of path)
+	modTime   time.Time
+	mediaType string
+	sha1Hash  []byte
+	dedupKey  string
+	info      os.FileInfo   // File as it was before hashing, nil if unknown
+	existing  string        // Media key of the library copy, set once the existence check found one
+	meta      *FileMetadata // Per-file overrides, set once the file is about to be uploaded
 
-		// Send total count with first event
-		workers := max(1, opts.Workers)
-		workers = min(workers, len(files))
+	liveVideo string      // Path of the video half of a Live Photo still, for events
+	video     *uploadItem // Video half to upload after the still, nil when there is none or it is skipped
+	liveStill bool        // Set on the video half of a Live Photo
+	spooled   bool        // path is a temp copy, of an archive member or a reader, with nothing on the host to remove
 
-		workChan := make(chan string, len(files))
-		var wg sync.WaitGroup
+	duplicateOf string // Path of an identical file of the same upload, set with existing to its media key
+}
 
-		// Start workers
-		for i := range workers {
-			wg.Add(1)
-			go func(workerID int) {
-				defer wg.Done()
-				for path := range workChan {
-					select {
-					case <-ctx.Done():
+// discard removes the temp copy of a spooled item once it is no longer needed
+func (item uploadItem) discard() {
+	if item.spooled {
+		os.Remove(item.path)
+	}
+}
+
+// inLibrary reports whether the library already holds the item and its video half
+func (item uploadItem) inLibrary() bool {
+	return item.existing != "" && (item.video == nil || item.video.existing != "")
+}
+
+// runWorkers calls fn for each item received using up to workers goroutines and
+// waits for them. Items still queued when ctx is cancelled are dropped.
+func runWorkers[T any](ctx context.Context, items <-chan T, workers int, fn func(workerID int, item T)) {
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case item, ok := <-items:
+					if !ok {
 						return
-					default:
 					}
-					uploadFile(ctx, g.Api, path, workerID, opts, events)
+					fn(workerID, item)
 				}
-			}(i)
-		}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
 
-		// Send work (with total on first)
-		first := true
-		for _, path := range files {
+// walkFiles streams the files to upload into out and reports unreadable paths as
+// failed. While walking, the running count is sent at most every progressInterval;
+// the batch total follows once the walk completes.
+func (g *GooglePhotosAPI) walkFiles(ctx context.Context, paths []string, filter *pathFilter, opts UploadOptions, out chan<- walkedFile, events chan<- UploadEvent) {
+	discovered := 0
+	lastReport := time.Now()
+	w := newWalker(filter, opts)
+	w.gate = g.diskGate(opts)
+	w.walk(paths, func(file walkedFile) bool {
+		discovered++
+		if now := time.Now(); now.Sub(lastReport) >= progressInterval {
+			lastReport = now
+			events <- UploadEvent{Discovered: discovered}
+		}
+		select {
+		case out <- file:
+		case <-ctx.Done():
+			return false
+		}
+		// The walker moves on to the next archive member once this one is read
+		if file.member != nil {
 			select {
+			case <-file.member.done:
 			case <-ctx.Done():
-				close(workChan)
-				wg.Wait()
-				return
-			default:
-			}
-			if first {
-				events <- UploadEvent{Total: len(files)}
-				first = false
+				return false
 			}
-			workChan <- path
 		}
-		close(workChan)
-		wg.Wait()
-	}()
+		return true
+	}, func(path string, err error) {
+		events <- UploadEvent{Path: path, Status: StatusFailed, Error: err}
+	})
+	if ctx.Err() == nil {
+		events <- UploadEvent{Total: discovered, Discovered: discovered}
+	}
+}
 
-	return events
+// hashItem hashes one file, and the video half of a Live Photo with it, reporting
+// progress and failures
+func (g *GooglePhotosAPI) hashItem(ctx context.Context, file walkedFile, workerID int, run *uploadRun, events chan<- UploadEvent) (uploadItem, bool) {
+	if file.member != nil {
+		defer close(file.member.done)
+	}
+	if !run.wait(ctx) {
+		return uploadItem{}, false
+	}
+	if file.member != nil {
+		item, err := g.spoolMember(ctx, file, workerID, run, events)
+		if err != nil {
+			events <- UploadEvent{Path: file.path, Status: StatusFailed, MediaType: item.mediaType, Error: err, WorkerID: workerID}
+			return uploadItem{}, false
+		}
+		return item, true
+	}
+	item, err := g.hashPath(ctx, file.root, file.path, file.mediaType, workerID, run, events)
+	item.liveVideo = file.video
+	if err == nil && file.video != "" && run.liveVideo != LivePhotoVideoSkip {
+		var video uploadItem
+		video, err = g.hashPath(ctx, file.root, file.video, file.videoType, workerID, run, events)
+		if err != nil {
+			err = fmt.Errorf("live photo video: %w", err)
+		}
+		video.liveStill = true
+		item.video = &video
+	}
+	if err != nil {
+		events <- UploadEvent{
+			Path: item.source, Status: StatusFailed, MediaType: item.mediaType, Error: err, WorkerID: workerID, LiveVideo: item.liveVideo,
+		}
+		return uploadItem{}, false
+	}
+	return item, true
 }
 
-func uploadFile(ctx context.Context, api *core.Api, filePath string, workerID int, opts UploadOptions, events chan<- UploadEvent) {
-	send := func(status UploadStatus, mediaKey, dedupKey string, err error) {
+// hashPath hashes the file at filePath into an uploadItem. mediaType is the one the
+// walk detected, "" has it detected here. The item's path and media type are set even
+// if hashing fails.
+func (g *GooglePhotosAPI) hashPath(ctx context.Context, root, filePath, mediaType string, workerID int, run *uploadRun, events chan<- UploadEvent) (uploadItem, error) {
+	if mediaType == "" {
+		run.gate.do(func() { mediaType, _ = resolveMediaType(filePath) })
+	}
+	item := uploadItem{path: filePath, source: filePath, root: root, mediaType: mediaType}
+	var size int64
+	info, err := os.Stat(filePath)
+	if err == nil {
+		size = info.Size()
+	}
+	events <- UploadEvent{
+		Path: filePath, Status: StatusHashing, MediaType: mediaType, WorkerID: workerID, BytesTotal: size,
+	}
+	progress := newProgressEmitter(func(done, total int64) {
 		events <- UploadEvent{
-			Path: filePath, Status: status, MediaKey: mediaKey, DedupKey: dedupKey, Error: err, WorkerID: workerID,
+			Path: filePath, Status: StatusHashing, MediaType: mediaType, WorkerID: workerID,
+			Progress: true, BytesDone: done, BytesTotal: total,
 		}
+	})
+	sha1Hash, err := g.hashFile(ctx, filePath, run, progress.report)
+	if err != nil {
+		return item, fmt.Errorf("hash error: %w", err)
 	}
+	item.sha1Hash = sha1Hash
+	item.dedupKey = core.SHA1ToDedupeKey(sha1Hash)
+	item.info = info
+	return item, nil
+}
 
-	// Hash file
-	send(StatusHashing, "", "", nil)
-	sha1Hash, err := CalculateSHA1(ctx, filePath)
+// spoolMember copies an archive member to a temp file while hashing it
+func (g *GooglePhotosAPI) spoolMember(ctx context.Context, file walkedFile, workerID int, run *uploadRun, events chan<- UploadEvent) (uploadItem, error) {
+	member := file.member
+	mediaType := member.mediaType
+	events <- UploadEvent{
+		Path: file.path, Status: StatusHashing, MediaType: mediaType, WorkerID: workerID, BytesTotal: member.size,
+	}
+	progress := newProgressEmitter(func(done, total int64) {
+		events <- UploadEvent{
+			Path: file.path, Status: StatusHashing, MediaType: mediaType, WorkerID: workerID,
+			Progress: true, BytesDone: done, BytesTotal: total,
+		}
+	})
+	item, err := spoolReader(ctx, member.r, file.path, member.size, member.modTime, run.spoolDir, progress.report)
+	progress.stop()
 	if err != nil {
-		send(StatusFailed, "", "", fmt.Errorf("hash error: %w", err))
-		return
+		return uploadItem{mediaType: mediaType}, err
 	}
-	dedupKey := core.SHA1ToDedupeKey(sha1Hash)
+	item.root = file.root
+	return item, nil
+}
 
-	// Check if exists
-	if !opts.ForceUpload {
-		send(StatusChecking, "", dedupKey, nil)
-		if mediaKey, _ := api.FindRemoteMediaByHash(sha1Hash); mediaKey != "" {
-			if opts.DeleteFromHost {
-				os.Remove(filePath)
+// checkItems groups hashed items into batches for skipExisting and forwards the
+// ones that need uploading. A partial batch is flushed after hashCheckFlushInterval
+// so a slow walk doesn't hold back uploads.
+func (g *GooglePhotosAPI) checkItems(ctx context.Context, in <-chan uploadItem, out chan<- uploadItem, run *uploadRun, opts UploadOptions, events chan<- UploadEvent) {
+	forward := func(items []uploadItem) bool {
+		for _, item := range items {
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return false
 			}
-			send(StatusSkipped, mediaKey, dedupKey, nil)
-			return
 		}
+		return true
 	}
 
-	// Get file info
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		send(StatusFailed, "", dedupKey, fmt.Errorf("stat error: %w", err))
+	if opts.ForceUpload {
+		for item := range in {
+			if !forward([]uploadItem{item}) {
+				return
+			}
+		}
 		return
 	}
 
-	// Upload
-	send(StatusUploading, "", dedupKey, nil)
-	sha1Base64 := base64.StdEncoding.EncodeToString([]byte(sha1Hash))
-	token, err := api.GetUploadToken(sha1Base64, fileInfo.Size())
-	if err != nil {
-		send(StatusFailed, "", dedupKey, fmt.Errorf("upload token error: %w", err))
-		return
+	ticker := time.NewTicker(hashCheckFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]uploadItem, 0, hashCheckBatchSize)
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		items := g.skipExisting(ctx, batch, run, opts, events)
+		batch = batch[:0]
+		return forward(items)
 	}
 
-	commitToken, err := api.UploadFile(ctx, filePath, token)
-	if err != nil {
-		send(StatusFailed, "", dedupKey, fmt.Errorf("upload error: %w", err))
-		return
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item, ok := <-in:
+			if !ok {
+				flush()
+				return
+			}
+			// Duplicates of uploaded files need no check
+			if item.duplicateOf != "" {
+				if !forward([]uploadItem{item}) {
+					return
+				}
+				continue
+			}
+			batch = append(batch, item)
+			if len(batch) >= hashCheckBatchSize && !flush() {
+				return
+			}
+		case <-ticker.C:
+			if !flush() {
+				return
+			}
+		}
 	}
+}
 
-	// Finalize
-	send(StatusFinalizing, "", dedupKey, nil)
-	mediaKey, err := api.CommitUpload(commitToken, fileInfo.Name(), sha1Hash, fileInfo.ModTime().Unix(), opts.Quality, opts.UseQuota)
-	if err != nil {
-		send(StatusFailed, "", dedupKey, fmt.Errorf("commit error: %w", err))
-		return
+// skipExisting checks all hashed items against the library in batches and reports
+// matches as skipped. Returns the items that still need uploading, plus matches that
+// are to be removed from the host, so that verification runs on the upload workers.
+func (g *GooglePhotosAPI) skipExisting(ctx context.Context, items []uploadItem, run *uploadRun, opts UploadOptions, events chan<- UploadEvent) []uploadItem {
+	var pending []uploadItem
+	for start := 0; start < len(items); start += hashCheckBatchSize {
+		if ctx.Err() != nil {
+			return nil
+		}
+		batch := items[start:min(start+hashCheckBatchSize, len(items))]
+
+		var hashes [][]byte
+		for _, item := range batch {
+			for _, half := range item.halves() {
+				hashes = append(hashes, half.sha1Hash)
+				events <- UploadEvent{Path: half.source, Status: StatusChecking, MediaType: half.mediaType, DedupKey: half.dedupKey}
+			}
+		}
+
+		found, err := g.FindRemoteMediaByHashes(ctx, hashes)
+		if err != nil && ctx.Err() == nil {
+			// Unchecked files are uploaded anyway, the server dedups by hash
+			slog.Warn("remote existence check failed", "error", err)
+		}
+
+		for _, item := range batch {
+			item.existing = found[item.dedupKey]
+			if item.video != nil {
+				item.video.existing = found[item.video.dedupKey]
+			}
+			if !item.inLibrary() || (opts.removesFromHost() && !item.spooled) {
+				pending = append(pending, item)
+				continue
+			}
+			events <- UploadEvent{
+				Path: item.source, Status: StatusSkipped, MediaType: item.mediaType, MediaKey: item.existing, DedupKey: item.dedupKey,
+				Albums: opts.metadataFor(item, run.gate).Albums, LiveVideo: item.liveVideo, LiveVideoMediaKey: item.videoKey(),
+			}
+			item.discard()
+			// Copies held back for this one are skipped on the upload workers
+			pending = append(pending, run.duplicates.resolve(item, item.existing)...)
+		}
 	}
-	if mediaKey == "" {
-		send(StatusFailed, "", dedupKey, fmt.Errorf("no media key returned"))
+	return pending
+}
+
+// halves returns the item and its Live Photo video half, if it has one
+func (item uploadItem) halves() []uploadItem {
+	if item.video == nil {
+		return []uploadItem{item}
+	}
+	return []uploadItem{item, *item.video}
+}
+
+// videoKey returns the media key of the library copy of the video half
+func (item uploadItem) videoKey() string {
+	if item.video == nil {
+		return ""
+	}
+	return item.video.existing
+}
+
+// uploadFile uploads an item, then its Live Photo video half, and reports the result
+// of both as one event
+func (g *GooglePhotosAPI) uploadFile(ctx context.Context, item uploadItem, workerID int, run *uploadRun, opts UploadOptions, events chan<- UploadEvent) {
+	defer item.discard()
+	item.meta = opts.metadataFor(item, run.gate)
+	status, mediaKey, err := g.placeItem(ctx, item, workerID, run, opts, events)
+	if status == "" {
 		return
 	}
+	event := UploadEvent{
+		Path: item.source, Status: status, MediaType: item.mediaType, MediaKey: mediaKey, DedupKey: item.dedupKey, Error: err, WorkerID: workerID,
+		LiveVideo: item.liveVideo,
+	}
+	if item.video != nil && status != StatusFailed {
+		video := *item.video
+		video.meta = opts.metadataFor(video, run.gate)
+		if run.liveVideo == LivePhotoVideoArchive {
+			video.meta.Archive = true
+		}
+		videoStatus, videoKey, err := g.placeItem(ctx, video, workerID, run, opts, events)
+		event.LiveVideoMediaKey = videoKey
+		switch videoStatus {
+		case StatusFailed:
+			event.Status, event.Error = StatusFailed, fmt.Errorf("live photo video: %w", err)
+		case StatusCompleted:
+			event.Status = StatusCompleted
+		}
+	}
+	if event.Status == StatusCompleted || event.Status == StatusSkipped {
+		event.Albums = item.meta.Albums
+		event.DuplicateOf = item.duplicateOf
+	}
+	events <- event
+
+	// Copies of the same content that waited for this one
+	switch {
+	case event.Status == StatusFailed && ctx.Err() == nil:
+		if next, ok := run.duplicates.fail(item); ok {
+			g.uploadFile(ctx, next, workerID, run, opts, events)
+		}
+	case event.Status != StatusFailed:
+		for _, duplicate := range run.duplicates.resolve(item, event.MediaKey) {
+			g.uploadFile(ctx, duplicate, workerID, run, opts, events)
+		}
+	}
+}
+
+// placeItem makes sure the library holds one file, uploading it unless it is already
+// there, and removes it from the host if asked to. It returns StatusCompleted,
+// StatusSkipped or StatusFailed, and no status if a stop came before the file started.
+func (g *GooglePhotosAPI) placeItem(ctx context.Context, item uploadItem, workerID int, run *uploadRun, opts UploadOptions, events chan<- UploadEvent) (UploadStatus, string, error) {
+	dedupKey := item.dedupKey
+	removes := opts.removesFromHost() && !item.spooled
+	if item.existing != "" {
+		if removes {
+			g.removeFromHost(ctx, item, item.existing, workerID, opts, events)
+		}
+		return StatusSkipped, item.existing, nil
+	}
+
+	var mediaKey string
+	for attempt := 1; ; attempt++ {
+		// The video half of a Live Photo counts as started with its still
+		if started := attempt > 1 || item.liveStill; !run.begin(ctx, started) {
+			if started || ctx.Err() != nil {
+				return StatusFailed, "", cmp.Or(ctx.Err(), context.Canceled)
+			}
+			return "", "", nil
+		}
+		var err error
+		mediaKey, err = g.uploadAttempt(ctx, item, workerID, run, opts, events)
+		run.observe(err)
+		run.release()
+		if err == nil {
+			break
+		}
+		if attempt > opts.Retries || ctx.Err() != nil || !IsTransientError(err) {
+			return StatusFailed, "", err
+		}
+		events <- UploadEvent{
+			Path: item.source, Status: StatusRetrying, MediaType: item.mediaType, DedupKey: dedupKey, Error: err, WorkerID: workerID, Attempt: attempt,
+		}
+		delay := retryDelay(opts.RetryDelay, attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			delay = max(delay, statusErr.RetryAfter)
+		}
+		if !sleepContext(ctx, delay) {
+			return StatusFailed, "", ctx.Err()
+		}
+	}
 
 	// Post-upload ops
-	if opts.Caption != "" {
-		if err := api.SetCaption(mediaKey, opts.Caption); err != nil {
-			slog.Error("caption failed", "path", filePath, "error", err)
+	caption := item.meta.Caption
+	if caption == "" {
+		var err error
+		if caption, err = run.captionFor(item); err != nil {
+			slog.Error("caption failed", "path", item.source, "error", err)
 		}
 	}
-	if opts.ShouldFavourite {
-		if err := api.SetFavourite(mediaKey, true); err != nil {
-			slog.Error("favourite failed", "path", filePath, "error", err)
+	if caption != "" {
+		if err := g.SetCaption(mediaKey, caption); err != nil {
+			slog.Error("caption failed", "path", item.source, "error", err)
 		}
 	}
-	if opts.ShouldArchive {
-		if err := api.SetArchived([]string{mediaKey}, true); err != nil {
-			slog.Error("archive failed", "path", filePath, "error", err)
+	if opts.ShouldFavourite || item.meta.Favourite {
+		if err := g.SetFavourite(mediaKey, true); err != nil {
+			slog.Error("favourite failed", "path", item.source, "error", err)
 		}
 	}
-	if opts.DeleteFromHost {
-		os.Remove(filePath)
+	if opts.ShouldArchive || item.meta.Archive {
+		if err := g.SetArchived([]string{mediaKey}, true); err != nil {
+			slog.Error("archive failed", "path", item.source, "error", err)
+		}
+	}
+	if removes {
+		g.removeFromHost(ctx, item, mediaKey, workerID, opts, events)
 	}
+	return StatusCompleted, mediaKey, nil
+}
+
+// uploadAttempt transfers and commits one file, returning its media key
+func (g *GooglePhotosAPI) uploadAttempt(ctx context.Context, item uploadItem, workerID int, run *uploadRun, opts UploadOptions, events chan<- UploadEvent) (string, error) {
+	filePath, sha1Hash, dedupKey := item.path, item.sha1Hash, item.dedupKey
 
-	send(StatusCompleted, mediaKey, dedupKey, nil)
+	// Get file info
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return "", fmt.Errorf("stat error: %w", err)
+	}
+
+	// Upload
+	size := fileInfo.Size()
+	events <- UploadEvent{
+		Path: item.source, Status: StatusUploading, MediaType: item.mediaType, DedupKey: dedupKey, WorkerID: workerID, BytesTotal: size,
+	}
+	progress := newProgressEmitter(func(done, total int64) {
+		events <- UploadEvent{
+			Path: item.source, Status: StatusUploading, MediaType: item.mediaType, DedupKey: dedupKey, WorkerID: workerID,
+			Progress: true, BytesDone: done, BytesTotal: total,
+		}
+	})
+	commitToken, err := g.transferFile(ctx, filePath, item.source, sha1Hash, dedupKey, size, run, progress.report)
+	progress.stop()
+	if err != nil {
+		return "", err
+	}
+
+	// Finalize
+	events <- UploadEvent{Path: item.source, Status: StatusFinalizing, MediaType: item.mediaType, DedupKey: dedupKey, WorkerID: workerID}
+	fileName, modTime := item.name, item.modTime
+	if fileName == "" {
+		fileName = fileInfo.Name()
+	}
+	if modTime.IsZero() {
+		modTime = fileInfo.ModTime()
+	}
+	if !item.meta.Timestamp.IsZero() {
+		modTime = item.meta.Timestamp
+	} else {
+		modTime = resolveTimestamp(filePath, modTime, opts.TimestampSource)
+	}
+	mediaKey, err := g.CommitUpload(commitToken, fileName, sha1Hash, modTime.Unix(), opts.Quality, opts.UseQuota)
+	if err != nil {
+		return "", fmt.Errorf("commit error: %w", err)
+	}
+	if mediaKey == "" {
+		return "", &RejectedError{Msg: "no media key returned"}
+	}
+	return mediaKey, nil
 }
 
 // isSupportedByGooglePhotos checks if a file extension is supported
@@ -222,48 +827,3 @@ func isSupportedByGooglePhotos(filename string) bool {
 	}
 	return slices.Contains(photoFormats, ext) || slices.Contains(videoFormats, ext)
 }
-
-func filterGooglePhotosFiles(paths []string, recursive, disableFilter bool) ([]string, error) {
-	var result []string
-	for _, path := range paths {
-		info, err := os.Stat(path)
-		if err != nil {
-			return nil, fmt.Errorf("error accessing %s: %w", path, err)
-		}
-		if info.IsDir() {
-			files, err := scanDir(path, recursive)
-			if err != nil {
-				return nil, err
-			}
-			for _, f := range files {
-				if disableFilter || isSupportedByGooglePhotos(f) {
-					result = append(result, f)
-				}
-			}
-		} else if disableFilter || isSupportedByGooglePhotos(path) {
-			result = append(result, path)
-		}
-	}
-	return result, nil
-}
-
-func scanDir(path string, recursive bool) ([]string, error) {
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return nil, err
-	}
-	var files []string
-	for _, e := range entries {
-		full := filepath.Join(path, e.Name())
-		if e.IsDir() && recursive {
-			sub, err := scanDir(full, true)
-			if err != nil {
-				return nil, err
-			}
-			files = append(files, sub...)
-		} else if !e.IsDir() {
-			files = append(files, full)
-		}
-	}
-	return files, nil
-}
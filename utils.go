@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -29,8 +30,21 @@ func DownloadFromReader(reader io.Reader, outputPath, filename string) (string,
 
 // DownloadFile downloads a file from the given URL to the specified output path
 // Returns the final output path
+//
+// Deprecated: DownloadFile uses http.DefaultClient, bypassing the proxy and
+// bandwidth limit. Use (*GooglePhotosAPI).DownloadURL instead.
 func DownloadFile(downloadURL, outputPath string) (string, error) {
-	resp, err := http.Get(downloadURL)
+	return downloadWithClient(http.DefaultClient, downloadURL, outputPath)
+}
+
+// DownloadURL downloads a file from the given URL to the specified output path through
+// the client's proxy and bandwidth limit. Returns the final output path.
+func (g *GooglePhotosAPI) DownloadURL(downloadURL, outputPath string) (string, error) {
+	return downloadWithClient(g.Client, downloadURL, outputPath)
+}
+
+func downloadWithClient(client *http.Client, downloadURL, outputPath string) (string, error) {
+	resp, err := client.Get(downloadURL)
 	if err != nil {
 		return "", fmt.Errorf("download request failed: %w", err)
 	}
@@ -146,7 +160,7 @@ func (g *GooglePhotosAPI) ResolveItemKey(ctx context.Context, input string) (str
 	// Check if input is a file path by trying to stat it
 	if _, err := os.Stat(input); err == nil {
 		// File exists, calculate SHA1 and convert to dedup key
-		hash, err := CalculateSHA1(ctx, input)
+		hash, err := g.hashFileAndSave(ctx, input)
 		if err != nil {
 			return "", fmt.Errorf("failed to calculate SHA1: %w", err)
 		}
@@ -185,7 +199,7 @@ func (g *GooglePhotosAPI) ResolveMediaKey(ctx context.Context, input string) (st
 	// Check if input is a file path by trying to stat it
 	if _, err := os.Stat(input); err == nil {
 		// File exists, calculate SHA1 and look up mediaKey
-		hash, err := CalculateSHA1(ctx, input)
+		hash, err := g.hashFileAndSave(ctx, input)
 		if err != nil {
 			return "", fmt.Errorf("failed to calculate SHA1: %w", err)
 		}
@@ -201,3 +215,15 @@ func (g *GooglePhotosAPI) ResolveMediaKey(ctx context.Context, input string) (st
 	// Assume it's already a media key
 	return input, nil
 }
+
+// hashFileAndSave hashes a single file and persists the hash cache immediately
+func (g *GooglePhotosAPI) hashFileAndSave(ctx context.Context, filePath string) ([]byte, error) {
+	hash, err := g.HashFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.hashCache.Save(); err != nil {
+		slog.Warn("failed to save hash cache", "error", err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,315 @@
+package gpm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walkReadBatch is how many directory entries are read at a time, so huge
+// directories are streamed instead of listed in full
+const walkReadBatch = 1024
+
+// walker streams the files under a set of upload roots, applying a pathFilter.
+// Only regular files are reported. Symlinks below a root are skipped unless
+// followSymlinks is set; roots given explicitly are always resolved.
+type walker struct {
+	filter         *pathFilter // nil accepts every file
+	recursive      bool
+	followSymlinks bool
+	livePhotos     bool                     // Pair Live Photo stills with their videos, see LivePhotoOptions
+	archives       bool                     // Read archives found in directories, archives given as paths always are
+	visited        map[string]bool          // Real paths of directories walked, for loop detection
+	rootOf         func(path string) string // Root of files given explicitly, see UploadOptions.rootOf
+	gate           *diskGate                // Turns for content sniffing and Live Photo identifiers
+
+	// skipped is called with every entry left out and the reason, if set
+	skipped func(path, reason string)
+}
+
+func newWalker(filter *pathFilter, opts UploadOptions) *walker {
+	return &walker{
+		filter:         filter,
+		recursive:      opts.Recursive,
+		followSymlinks: opts.FollowSymlinks,
+		livePhotos:     opts.LivePhotos != nil,
+		archives:       opts.Archives,
+		visited:        make(map[string]bool),
+		rootOf:         opts.rootOf,
+	}
+}
+
+// explicitRoot returns the upload root of a file given explicitly
+func (w *walker) explicitRoot(path string) string {
+	if w.rootOf != nil {
+		return w.rootOf(path)
+	}
+	return filepath.Dir(path)
+}
+
+// walkedFile is a file found by a walker and the upload root it was found under
+type walkedFile struct {
+	root      string // Root given to walk, or the file's own directory if the root is the file (see explicitRoot)
+	path      string
+	mediaType string         // Detected by the filter, "" if it wasn't
+	video     string         // Video half of a Live Photo still, found when livePhotos is set
+	videoType string         // Media type of video, "" if it wasn't detected
+	member    *archiveMember // Set for files inside an archive, whose path is not on disk
+}
+
+// walk calls found for every accepted file and onError for every path that can't be
+// read, then carries on. It stops early when found returns false.
+// Files given explicitly only pair with other files given explicitly.
+func (w *walker) walk(paths []string, found func(file walkedFile) bool, onError func(path string, err error)) {
+	var pairs *livePhotoPairs
+	var types map[string]string // Media types of explicit files, detected while pairing
+	if w.livePhotos {
+		pairs, types = w.explicitPairs(paths)
+	}
+	// Members given by path, as in a list of failed files, are read in one pass per archive
+	members := archiveMembers(paths)
+	read := make(map[string]bool)
+	for _, path := range paths {
+		if archive, _, ok := strings.Cut(path, ArchiveSeparator); ok && members[archive] != nil {
+			if !read[archive] {
+				read[archive] = true
+				if !w.walkArchive(archive, members[archive], found, onError) {
+					return
+				}
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			onError(path, err)
+			continue
+		}
+		if info.IsDir() {
+			if !w.walkDir(path, path, found, onError) {
+				return
+			}
+			continue
+		}
+		if info.Mode().IsRegular() && isArchive(path) {
+			if !w.walkArchive(path, nil, found, onError) {
+				return
+			}
+			continue
+		}
+		mediaType, reason := w.fileSkipReason(path, info)
+		if reason != "" {
+			w.skip(path, reason)
+			continue
+		}
+		if pairs.isCarried(path) {
+			continue
+		}
+		video := pairs.video(path)
+		if !found(walkedFile{root: w.explicitRoot(path), path: path, mediaType: mediaType, video: video, videoType: types[video]}) {
+			return
+		}
+	}
+}
+
+// fileSkipReason returns why a file given explicitly is left out, empty if it isn't,
+// and the media type the filter detected
+func (w *walker) fileSkipReason(path string, info os.FileInfo) (mediaType, reason string) {
+	if !info.Mode().IsRegular() {
+		return "", "not a regular file"
+	}
+	if w.filter != nil {
+		root := w.explicitRoot(path)
+		if mediaType, reason = w.check(root, path); reason != "" {
+			return "", reason
+		}
+		if w.filter.excludedWithParents(root, path) {
+			return "", "excluded"
+		}
+	}
+	return mediaType, ""
+}
+
+// check is filter.check, sniffing the file in a turn of the gate
+func (w *walker) check(root, path string) (mediaType, reason string) {
+	w.gate.do(func() { mediaType, reason = w.filter.check(root, path) })
+	return mediaType, reason
+}
+
+// identifier is livePhotoIdentifier, reading the file in a turn of the gate
+func (w *walker) identifier(path string) string {
+	var id string
+	w.gate.do(func() { id = livePhotoIdentifier(path) })
+	return id
+}
+
+// explicitPairs pairs the Live Photo halves among files given explicitly, also
+// returning the media types the filter detected for them
+func (w *walker) explicitPairs(paths []string) (*livePhotoPairs, map[string]string) {
+	byDir := make(map[string][]string)
+	types := make(map[string]string)
+	var dirs []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		mediaType, reason := w.fileSkipReason(path, info)
+		if reason != "" {
+			continue
+		}
+		types[path] = mediaType
+		dir := filepath.Dir(path)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], filepath.Base(path))
+	}
+	pairs := newLivePhotoPairs()
+	for _, dir := range dirs {
+		pairs.add(dir, byDir[dir], w.identifier)
+	}
+	return pairs, types
+}
+
+// pairBatch pairs the Live Photo halves held back from one read batch of dir and
+// reports them, the videos with their stills. Halves that land in different batches,
+// which only happens in directories of more than walkReadBatch entries, are uploaded
+// as separate files.
+func (w *walker) pairBatch(dir string, held []walkedFile, found func(walkedFile) bool) bool {
+	if len(held) == 0 {
+		return true
+	}
+	names := make([]string, len(held))
+	for i, file := range held {
+		names[i] = filepath.Base(file.path)
+	}
+	pairs := newLivePhotoPairs()
+	pairs.add(dir, names, w.identifier)
+	types := make(map[string]string, len(held))
+	for _, file := range held {
+		types[file.path] = file.mediaType
+	}
+	for _, file := range held {
+		if pairs.isCarried(file.path) {
+			continue
+		}
+		file.video = pairs.video(file.path)
+		file.videoType = types[file.video]
+		if !found(file) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *walker) skip(path, reason string) {
+	if w.skipped != nil {
+		w.skipped(path, reason)
+	}
+}
+
+// walkDir streams the entries of dir, descending into subdirectories when recursive
+func (w *walker) walkDir(root, dir string, found func(walkedFile) bool, onError func(string, error)) bool {
+	if w.followSymlinks {
+		// A directory reached twice through links would otherwise be walked forever
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			onError(dir, err)
+			return true
+		}
+		if w.visited[real] {
+			return true
+		}
+		w.visited[real] = true
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		onError(dir, fmt.Errorf("error reading directory: %w", err))
+		return true
+	}
+	defer f.Close()
+
+	for {
+		entries, err := f.ReadDir(walkReadBatch)
+		var held []walkedFile // Accepted Live Photo halves, paired once the batch is read
+		hold := func(file walkedFile) { held = append(held, file) }
+		if !w.livePhotos {
+			hold = nil
+		}
+		for _, e := range entries {
+			if !w.visit(root, filepath.Join(dir, e.Name()), e, hold, found, onError) {
+				return false
+			}
+		}
+		if !w.pairBatch(dir, held, found) {
+			return false
+		}
+		if errors.Is(err, io.EOF) {
+			return true
+		}
+		if err != nil {
+			onError(dir, fmt.Errorf("error reading directory: %w", err))
+			return true
+		}
+	}
+}
+
+// visit handles one directory entry, returning false to stop the walk. Accepted files
+// that may be half of a Live Photo go to hold instead of found if it is set.
+func (w *walker) visit(root, path string, e fs.DirEntry, hold func(walkedFile), found func(walkedFile) bool, onError func(string, error)) bool {
+	mode := e.Type()
+	if mode&fs.ModeSymlink != 0 {
+		if !w.followSymlinks {
+			w.skip(path, "symlink")
+			return true
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			onError(path, fmt.Errorf("broken symlink: %w", err))
+			return true
+		}
+		mode = info.Mode().Type()
+	}
+
+	switch {
+	case mode.IsDir():
+		if !w.recursive {
+			w.skip(path, "directory (not recursive)")
+			return true
+		}
+		if w.filter != nil && w.filter.excluded(root, path, true) {
+			w.skip(path, "excluded")
+			return true
+		}
+		return w.walkDir(root, path, found, onError)
+	case mode.IsRegular():
+		if w.filter != nil && w.filter.excluded(root, path, false) {
+			w.skip(path, "excluded")
+			return true
+		}
+		if w.archives && isArchive(path) {
+			return w.walkArchive(path, nil, found, onError)
+		}
+		var mediaType string
+		if w.filter != nil {
+			var reason string
+			if mediaType, reason = w.check(root, path); reason != "" {
+				w.skip(path, reason)
+				return true
+			}
+		}
+		if hold != nil && isLivePhotoHalf(path) {
+			hold(walkedFile{root: root, path: path, mediaType: mediaType})
+			return true
+		}
+		return found(walkedFile{root: root, path: path, mediaType: mediaType})
+	}
+	// Devices, sockets and pipes are never media
+	w.skip(path, "not a regular file")
+	return true
+}
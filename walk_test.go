@@ -0,0 +1,121 @@
+package gpm
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWalkerLivePhotos(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"IMG_0001.HEIC", "IMG_0001.MOV", "IMG_0002.JPG", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		livePhotos bool
+		want       map[string]string // File name to the name of its video
+	}{
+		{
+			name:       "paired",
+			livePhotos: true,
+			want:       map[string]string{"IMG_0001.HEIC": "IMG_0001.MOV", "IMG_0002.JPG": "", "notes.txt": ""},
+		},
+		{
+			name: "unpaired",
+			want: map[string]string{"IMG_0001.HEIC": "", "IMG_0001.MOV": "", "IMG_0002.JPG": "", "notes.txt": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newPathFilter(UploadOptions{DisableFilter: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := UploadOptions{}
+			if tt.livePhotos {
+				opts.LivePhotos = &LivePhotoOptions{}
+			}
+			w := newWalker(filter, opts)
+
+			got := make(map[string]string)
+			w.walk([]string{dir}, func(file walkedFile) bool {
+				video := ""
+				if file.video != "" {
+					video = filepath.Base(file.video)
+				}
+				got[filepath.Base(file.path)] = video
+				return true
+			}, func(path string, err error) { t.Errorf("%s: %v", path, err) })
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("walk found %v, want %v", slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(tt.want)))
+			}
+			for name, video := range tt.want {
+				if v, ok := got[name]; !ok || v != video {
+					t.Errorf("%s: video %q (found %v), want %q", name, v, ok, video)
+				}
+			}
+		})
+	}
+}
+
+func TestWalkerMediaTypes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"IMG_0001.HEIC": "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic",
+		"IMG_0001.MOV":  "\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  ",
+		"photo.dat":     "\xFF\xD8\xFF\xE0jpeg", // Named by content
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		paths         []string
+		disableFilter bool
+		want          map[string][2]string // File name to its media type and its video's
+	}{
+		{
+			name:  "directory",
+			paths: []string{dir},
+			want:  map[string][2]string{"IMG_0001.HEIC": {"image/heic", "video/quicktime"}, "photo.dat": {"image/jpeg", ""}},
+		},
+		{
+			name:  "explicit files",
+			paths: []string{filepath.Join(dir, "IMG_0001.HEIC"), filepath.Join(dir, "IMG_0001.MOV"), filepath.Join(dir, "photo.dat")},
+			want:  map[string][2]string{"IMG_0001.HEIC": {"image/heic", "video/quicktime"}, "photo.dat": {"image/jpeg", ""}},
+		},
+		{
+			name:          "filter disabled",
+			paths:         []string{dir},
+			disableFilter: true,
+			want:          map[string][2]string{"IMG_0001.HEIC": {"", ""}, "photo.dat": {"", ""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := UploadOptions{DisableFilter: tt.disableFilter, LivePhotos: &LivePhotoOptions{}}
+			filter, err := newPathFilter(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][2]string)
+			newWalker(filter, opts).walk(tt.paths, func(file walkedFile) bool {
+				got[filepath.Base(file.path)] = [2]string{file.mediaType, file.videoType}
+				return true
+			}, func(path string, err error) { t.Errorf("%s: %v", path, err) })
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("media types = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
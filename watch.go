@@ -0,0 +1,254 @@
+package gpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	watchPollInterval = 1 * time.Second // How often pending files are checked
+	watchSettleDelay  = 3 * time.Second // Quiet period before a file is considered finished
+)
+
+// pendingFile tracks a file that changed recently and may still be written to
+type pendingFile struct {
+	lastChange time.Time
+	size       int64
+	modTime    time.Time
+}
+
+// Watch uploads the files under paths and then keeps watching them, uploading new
+// files once they stop changing. Events are emitted exactly as for Upload, one
+// batch after another, until ctx is cancelled and the channel is closed. Stopping
+// UploadOptions.Control ends the watch once the running batch has wound down.
+func (g *GooglePhotosAPI) Watch(ctx context.Context, paths []string, opts UploadOptions) <-chan UploadEvent {
+	events := make(chan UploadEvent)
+
+	go func() {
+		defer close(events)
+
+		filter, err := newPathFilter(opts)
+		if err != nil {
+			events <- UploadEvent{Status: StatusFailed, Error: err}
+			return
+		}
+		w := &treeWatcher{roots: paths, recursive: opts.Recursive, followSymlinks: opts.FollowSymlinks, filter: filter}
+		// Settled files are uploaded by path but keep the root they were found under,
+		// for MoveTo and captions, as in a one-shot upload of the tree
+		opts.rootOf = w.rootFor
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			events <- UploadEvent{Status: StatusFailed, Error: fmt.Errorf("failed to start watcher: %w", err)}
+			return
+		}
+		defer watcher.Close()
+		w.watcher = watcher
+
+		for _, path := range paths {
+			if err := w.add(path); err != nil {
+				events <- UploadEvent{Status: StatusFailed, Error: fmt.Errorf("failed to watch %s: %w", path, err)}
+				return
+			}
+		}
+
+		// Upload what is already there, then only what changes
+		uploading := g.Upload(ctx, paths, opts)
+		pending := make(map[string]*pendingFile)
+		rescan := false
+
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				if uploading != nil {
+					for range uploading {
+					}
+				}
+				return
+
+			case <-opts.Control.stopped():
+				if uploading != nil {
+					for event := range uploading {
+						events <- event
+					}
+				}
+				return
+
+			case event, ok := <-uploading:
+				if !ok {
+					uploading = nil
+					continue
+				}
+				events <- event
+
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				w.handle(ev, pending)
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				if errors.Is(err, fsnotify.ErrEventOverflow) {
+					// Events were dropped, fall back to a full pass
+					slog.Warn("watch events overflowed, rescanning")
+					rescan = true
+				} else {
+					slog.Warn("watch error", "error", err)
+				}
+
+			case now := <-ticker.C:
+				if uploading != nil {
+					continue
+				}
+				if rescan {
+					rescan = false
+					clear(pending)
+					uploading = g.Upload(ctx, paths, opts)
+					continue
+				}
+				if ready := w.accepted(settledFiles(pending, now)); len(ready) > 0 {
+					uploading = g.Upload(ctx, ready, opts)
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+// treeWatcher keeps fsnotify watches on the upload roots and filters what they report
+type treeWatcher struct {
+	watcher        *fsnotify.Watcher
+	roots          []string
+	recursive      bool
+	followSymlinks bool
+	filter         *pathFilter
+}
+
+// rootFor returns the upload root that contains path
+func (w *treeWatcher) rootFor(path string) string {
+	for _, root := range w.roots {
+		if info, err := os.Stat(root); err == nil && !info.IsDir() {
+			root = filepath.Dir(root)
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return root
+		}
+	}
+	return filepath.Dir(path)
+}
+
+// add watches path, including subdirectories that are not excluded when recursive
+func (w *treeWatcher) add(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() || !w.recursive {
+		return w.watcher.Add(path)
+	}
+	root := w.rootFor(path)
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != root && w.filter.excluded(root, p, true) {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(p)
+	})
+}
+
+// handle records created or written files as pending and starts watching new directories
+func (w *treeWatcher) handle(ev fsnotify.Event, pending map[string]*pendingFile) {
+	switch {
+	case ev.Has(fsnotify.Create):
+		info, err := os.Stat(ev.Name)
+		if err != nil {
+			return
+		}
+		if !info.IsDir() {
+			markPending(pending, ev.Name, time.Now())
+			return
+		}
+		if !w.recursive || w.filter.excludedWithParents(w.rootFor(ev.Name), ev.Name) {
+			return
+		}
+		// A directory moved or created in place may already contain files
+		if err := w.add(ev.Name); err != nil {
+			slog.Warn("failed to watch directory", "path", ev.Name, "error", err)
+		}
+		walk := &walker{recursive: true, followSymlinks: w.followSymlinks, visited: make(map[string]bool)}
+		walk.walk([]string{ev.Name}, func(file walkedFile) bool {
+			markPending(pending, file.path, time.Now())
+			return true
+		}, func(path string, err error) {
+			slog.Warn("failed to scan directory", "path", path, "error", err)
+		})
+	case ev.Has(fsnotify.Write):
+		markPending(pending, ev.Name, time.Now())
+	case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+		delete(pending, ev.Name)
+	}
+}
+
+// accepted drops files rejected by the filter relative to their watched root
+func (w *treeWatcher) accepted(files []string) []string {
+	var out []string
+	for _, f := range files {
+		if w.filter.accepts(w.rootFor(f), f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// markPending records a change to path at now, restarting its quiet period
+func markPending(pending map[string]*pendingFile, path string, now time.Time) {
+	if p, ok := pending[path]; ok {
+		p.lastChange = now
+		return
+	}
+	pending[path] = &pendingFile{lastChange: now, size: -1}
+}
+
+// settledFiles returns pending files that have been quiet for watchSettleDelay and whose
+// size and mtime did not change since the previous check, removing them from pending
+func settledFiles(pending map[string]*pendingFile, now time.Time) []string {
+	var ready []string
+	for path, p := range pending {
+		if now.Sub(p.lastChange) < watchSettleDelay {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			delete(pending, path)
+			continue
+		}
+		if info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+			p.size, p.modTime = info.Size(), info.ModTime()
+			continue
+		}
+		ready = append(ready, path)
+		delete(pending, path)
+	}
+	return ready
+}
@@ -0,0 +1,152 @@
+package gpm
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestSettledFiles(t *testing.T) {
+	type step struct {
+		at     time.Duration // Since the file was first seen
+		action string        // "write", "touch" (a change event), "remove", "rename" or "" (tick)
+		ready  bool          // The file is returned by settledFiles at this tick
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "settles after the quiet period and a stable check",
+			steps: []step{
+				{at: time.Second},
+				{at: watchSettleDelay}, // First check records size and mtime
+				{at: watchSettleDelay + time.Second, ready: true},
+			},
+		},
+		{
+			name: "a change event restarts the quiet period",
+			steps: []step{
+				{at: 2 * time.Second, action: "touch"},
+				{at: watchSettleDelay},
+				{at: watchSettleDelay + time.Second},
+				{at: 2*time.Second + watchSettleDelay},
+				{at: 3*time.Second + watchSettleDelay, ready: true},
+			},
+		},
+		{
+			name: "rewritten while pending without an event",
+			steps: []step{
+				{at: watchSettleDelay},
+				{at: watchSettleDelay + time.Second, action: "write"}, // Size differs from the first check
+				{at: watchSettleDelay + 2*time.Second, ready: true},
+			},
+		},
+		{
+			name: "removed before it settles",
+			steps: []step{
+				{at: time.Second, action: "remove"},
+				{at: watchSettleDelay},
+				{at: watchSettleDelay + time.Second},
+			},
+		},
+		{
+			name: "renamed away before it settles",
+			steps: []step{
+				{at: time.Second, action: "rename"},
+				{at: watchSettleDelay + time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "IMG_0001.JPG")
+			if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			w := &treeWatcher{roots: []string{dir}}
+			pending := make(map[string]*pendingFile)
+			start := time.Now()
+			markPending(pending, path, start)
+
+			for _, s := range tt.steps {
+				now := start.Add(s.at)
+				switch s.action {
+				case "write":
+					if err := os.WriteFile(path, []byte("the whole photo"), 0644); err != nil {
+						t.Fatal(err)
+					}
+				case "touch":
+					markPending(pending, path, now)
+				case "remove":
+					os.Remove(path)
+					w.handle(fsnotify.Event{Name: path, Op: fsnotify.Remove}, pending)
+				case "rename":
+					if err := os.Rename(path, path+".tmp"); err != nil {
+						t.Fatal(err)
+					}
+					w.handle(fsnotify.Event{Name: path, Op: fsnotify.Rename}, pending)
+				}
+				ready := settledFiles(pending, now)
+				if got := slices.Contains(ready, path); got != s.ready {
+					t.Fatalf("at %v: ready = %v, want %v", s.at, got, s.ready)
+				}
+			}
+			if len(pending) != 0 {
+				t.Errorf("pending left with %d files", len(pending))
+			}
+		})
+	}
+}
+
+func TestWatchBatchKeepsRoot(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "2021", "Trip", "IMG_0001.JPG")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("\xFF\xD8\xFF\xE0jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		rootOf   func(string) string
+		include  []string
+		wantRoot string // "" if the file is left out
+	}{
+		{"own directory without a watch", nil, nil, filepath.Dir(file)},
+		{"watched root", (&treeWatcher{roots: []string{root}}).rootFor, nil, root},
+		{"include relative to the watched root", (&treeWatcher{roots: []string{root}}).rootFor, []string{"2021/Trip/*.JPG"}, root},
+		{"include not relative to the file's directory", nil, []string{"2021/Trip/*.JPG"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := UploadOptions{Include: tt.include, rootOf: tt.rootOf}
+			filter, err := newPathFilter(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var roots []string
+			newWalker(filter, opts).walk([]string{file}, func(f walkedFile) bool {
+				roots = append(roots, f.root)
+				return true
+			}, func(path string, err error) { t.Errorf("%s: %v", path, err) })
+
+			if tt.wantRoot == "" {
+				if len(roots) != 0 {
+					t.Errorf("file found under %v, want it left out", roots)
+				}
+				return
+			}
+			if len(roots) != 1 || roots[0] != tt.wantRoot {
+				t.Errorf("found under %v, want %s", roots, tt.wantRoot)
+			}
+		})
+	}
+}
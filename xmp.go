@@ -0,0 +1,288 @@
+package gpm
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// XMP namespaces of the properties that are read
+const (
+	nsRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsXMP = "http://ns.adobe.com/xap/1.0/"
+	nsLR  = "http://ns.adobe.com/lightroom/1.0/"
+)
+
+const (
+	xmpHeadScan = 2 * 1024 * 1024 // Embedded packets are looked for this far into a file
+	xmpTailScan = 1024 * 1024     // and this far from its end, where videos keep theirs
+	xmpMaxSize  = 1024 * 1024     // Longest packet read
+)
+
+// XMPMetadata holds the XMP properties used when uploading
+type XMPMetadata struct {
+	Title       string   // dc:title
+	Description string   // dc:description
+	Rating      int      // xmp:Rating, 0 if unrated and -1 for rejected files
+	Label       string   // xmp:Label, the colour label
+	Keywords    []string // dc:subject and the leaves of lr:hierarchicalSubject
+}
+
+// XMPMapping turns XMP metadata into upload settings, see UploadOptions.XMP
+type XMPMapping struct {
+	Caption         bool           // Caption files with dc:description, or dc:title if there is none
+	FavouriteRating int            // Favourite files rated at least this, 0 never does
+	Albums          []XMPAlbumRule // Add files to albums by keyword or label
+}
+
+// XMPAlbumRule adds files with a keyword or colour label to an album
+// Matching ignores case. Rules with both Keyword and Label need both to match.
+type XMPAlbumRule struct {
+	Keyword string // Keyword to match, "*" for each keyword a file has
+	Label   string // Colour label to match
+	Album   string // Album to add to, empty for the matched keyword or label
+}
+
+// ParseXMPAlbumRule parses a rule written "keyword:VALUE[=ALBUM]" or "label:VALUE[=ALBUM]"
+func ParseXMPAlbumRule(s string) (XMPAlbumRule, error) {
+	kind, rest, ok := strings.Cut(s, ":")
+	value, album, _ := strings.Cut(rest, "=")
+	value, album = strings.TrimSpace(value), strings.TrimSpace(album)
+	if !ok || value == "" {
+		return XMPAlbumRule{}, fmt.Errorf("invalid XMP album rule %q (use keyword:VALUE[=ALBUM] or label:VALUE[=ALBUM])", s)
+	}
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "keyword":
+		return XMPAlbumRule{Keyword: value, Album: album}, nil
+	case "label":
+		if value == "*" {
+			return XMPAlbumRule{}, fmt.Errorf("invalid XMP album rule %q: only keywords can use *", s)
+		}
+		return XMPAlbumRule{Label: value, Album: album}, nil
+	}
+	return XMPAlbumRule{}, fmt.Errorf("invalid XMP album rule %q: unknown kind %q (use keyword or label)", s, kind)
+}
+
+// albums returns the albums meta is added to by the rule
+func (r XMPAlbumRule) albums(meta *XMPMetadata) []string {
+	if r.Label != "" && !strings.EqualFold(r.Label, meta.Label) {
+		return nil
+	}
+	if r.Keyword == "" {
+		return []string{cmp.Or(r.Album, meta.Label)}
+	}
+	var albums []string
+	for _, keyword := range meta.Keywords {
+		if r.Keyword == "*" {
+			albums = append(albums, cmp.Or(r.Album, keyword))
+		} else if strings.EqualFold(r.Keyword, keyword) {
+			return []string{cmp.Or(r.Album, keyword)}
+		}
+	}
+	return albums
+}
+
+// apply adds what the mapping makes of meta to fm
+func (m *XMPMapping) apply(meta *XMPMetadata, fm *FileMetadata) {
+	if m.Caption && fm.Caption == "" {
+		fm.Caption = cmp.Or(meta.Description, meta.Title)
+	}
+	if m.FavouriteRating > 0 && meta.Rating >= m.FavouriteRating {
+		fm.Favourite = true
+	}
+	for _, rule := range m.Albums {
+		for _, album := range rule.albums(meta) {
+			if album != "" && !containsFold(fm.Albums, album) {
+				fm.Albums = append(fm.Albums, album)
+			}
+		}
+	}
+}
+
+// ReadXMP reads the XMP of a media file from its sidecar, "IMG_0001.CR3.xmp" or
+// "IMG_0001.xmp", and from the packet embedded in the file. Properties set in the
+// sidecar take precedence. Files without XMP return empty metadata.
+func ReadXMP(path string) (*XMPMetadata, error) {
+	meta, err := readEmbeddedXMP(path)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(path)
+	for _, sidecar := range []string{path + ".xmp", strings.TrimSuffix(path, ext) + ".xmp"} {
+		data, err := os.ReadFile(sidecar)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		side, err := parseXMP(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XMP sidecar %s: %w", sidecar, err)
+		}
+		meta.merge(side)
+		break
+	}
+	return meta, nil
+}
+
+// merge overrides m with the properties set in other
+func (m *XMPMetadata) merge(other *XMPMetadata) {
+	m.Title = cmp.Or(other.Title, m.Title)
+	m.Description = cmp.Or(other.Description, m.Description)
+	if other.Rating != 0 {
+		m.Rating = other.Rating
+	}
+	m.Label = cmp.Or(other.Label, m.Label)
+	if len(other.Keywords) > 0 {
+		m.Keywords = other.Keywords
+	}
+}
+
+// readEmbeddedXMP finds the XMP packet near the start or end of a file
+func readEmbeddedXMP(path string) (*XMPMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := info.Size()
+	windows := [][2]int64{{0, min(size, xmpHeadScan)}}
+	if size > xmpHeadScan {
+		windows = append(windows, [2]int64{max(xmpHeadScan, size-xmpTailScan), size})
+	}
+	for _, w := range windows {
+		buf := make([]byte, w[1]-w[0])
+		if _, err := file.ReadAt(buf, w[0]); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if packet := findXMPPacket(buf); packet != nil {
+			meta, err := parseXMP(packet)
+			if err != nil {
+				// A damaged packet is no reason to fail the upload
+				return &XMPMetadata{}, nil
+			}
+			return meta, nil
+		}
+	}
+	return &XMPMetadata{}, nil
+}
+
+// findXMPPacket returns the x:xmpmeta element in buf, nil if there is none
+func findXMPPacket(buf []byte) []byte {
+	start := bytes.Index(buf, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(buf[start:], []byte("</x:xmpmeta>"))
+	if end < 0 || end > xmpMaxSize {
+		return nil
+	}
+	return buf[start : start+end+len("</x:xmpmeta>")]
+}
+
+// parseXMP reads the properties of XMPMetadata from an XMP document. Properties
+// may be written as attributes of rdf:Description or as elements, with array
+// values in rdf:Alt, rdf:Bag or rdf:Seq items.
+func parseXMP(data []byte) (*XMPMetadata, error) {
+	meta := &XMPMetadata{}
+	var hierarchical []string
+	set := func(name xml.Name, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		switch name {
+		case xml.Name{Space: nsDC, Local: "title"}:
+			meta.Title = cmp.Or(meta.Title, value)
+		case xml.Name{Space: nsDC, Local: "description"}:
+			meta.Description = cmp.Or(meta.Description, value)
+		case xml.Name{Space: nsDC, Local: "subject"}:
+			meta.Keywords = append(meta.Keywords, value)
+		case xml.Name{Space: nsLR, Local: "hierarchicalSubject"}:
+			hierarchical = append(hierarchical, value)
+		case xml.Name{Space: nsXMP, Local: "Rating"}:
+			if rating, err := strconv.ParseFloat(value, 64); err == nil {
+				meta.Rating = int(rating)
+			}
+		case xml.Name{Space: nsXMP, Local: "Label"}:
+			meta.Label = value
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var property xml.Name // Property element being read, zero outside of one
+	var text strings.Builder
+	depth, descriptionDepth := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case t.Name == xml.Name{Space: nsRDF, Local: "Description"} && descriptionDepth == 0:
+				descriptionDepth = depth
+				for _, attr := range t.Attr {
+					set(attr.Name, attr.Value)
+				}
+			case descriptionDepth > 0 && depth == descriptionDepth+1:
+				property = t.Name
+				text.Reset()
+			case t.Name == xml.Name{Space: nsRDF, Local: "li"}:
+				text.Reset()
+			}
+		case xml.CharData:
+			if property.Local != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case depth == descriptionDepth:
+				descriptionDepth = 0
+			case descriptionDepth > 0 && depth == descriptionDepth+1:
+				set(property, text.String())
+				property = xml.Name{}
+			case property.Local != "" && t.Name == xml.Name{Space: nsRDF, Local: "li"}:
+				set(property, text.String())
+				text.Reset()
+			}
+			depth--
+		}
+	}
+
+	// "Places|France|Paris" adds Paris, unless dc:subject already has it
+	for _, path := range hierarchical {
+		leaf := path[strings.LastIndex(path, "|")+1:]
+		if !containsFold(meta.Keywords, leaf) {
+			meta.Keywords = append(meta.Keywords, leaf)
+		}
+	}
+	return meta, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
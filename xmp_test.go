@@ -0,0 +1,114 @@
+package gpm
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseXMP(t *testing.T) {
+	const head = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`
+	const tail = `</rdf:RDF></x:xmpmeta>`
+	const ns = `xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:lr="http://ns.adobe.com/lightroom/1.0/"`
+
+	tests := []struct {
+		name    string
+		body    string
+		want    XMPMetadata
+		wantErr bool
+	}{
+		{
+			name: "attributes",
+			body: `<rdf:Description ` + ns + ` xmp:Rating="4" xmp:Label="Red"/>`,
+			want: XMPMetadata{Rating: 4, Label: "Red"},
+		},
+		{
+			name: "elements",
+			body: `<rdf:Description ` + ns + `><xmp:Rating>5</xmp:Rating><xmp:Label> Green </xmp:Label></rdf:Description>`,
+			want: XMPMetadata{Rating: 5, Label: "Green"},
+		},
+		{
+			name: "rdf:Alt",
+			body: `<rdf:Description ` + ns + `>
+				<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Sunset</rdf:li><rdf:li xml:lang="fr">Coucher</rdf:li></rdf:Alt></dc:title>
+				<dc:description><rdf:Alt><rdf:li xml:lang="x-default">At the beach</rdf:li></rdf:Alt></dc:description>
+			</rdf:Description>`,
+			want: XMPMetadata{Title: "Sunset", Description: "At the beach"},
+		},
+		{
+			name: "rdf:Bag and hierarchical keywords",
+			body: `<rdf:Description ` + ns + `>
+				<dc:subject><rdf:Bag><rdf:li>beach</rdf:li><rdf:li>Paris</rdf:li></rdf:Bag></dc:subject>
+				<lr:hierarchicalSubject><rdf:Bag><rdf:li>Places|France|paris</rdf:li><rdf:li>People|Anna</rdf:li></rdf:Bag></lr:hierarchicalSubject>
+			</rdf:Description>`,
+			want: XMPMetadata{Keywords: []string{"beach", "Paris", "Anna"}},
+		},
+		{
+			name: "several descriptions",
+			body: `<rdf:Description ` + ns + ` xmp:Rating="2"/><rdf:Description ` + ns + `><xmp:Label>Blue</xmp:Label></rdf:Description>`,
+			want: XMPMetadata{Rating: 2, Label: "Blue"},
+		},
+		{
+			name: "rejected",
+			body: `<rdf:Description ` + ns + ` xmp:Rating="-1"/>`,
+			want: XMPMetadata{Rating: -1},
+		},
+		{
+			name: "unknown properties and empty values",
+			body: `<rdf:Description ` + ns + ` xmlns:foo="urn:foo" foo:Rating="5" xmp:Label=""><foo:title>Other</foo:title></rdf:Description>`,
+			want: XMPMetadata{},
+		},
+		{
+			name:    "malformed",
+			body:    `<rdf:Description ` + ns + `><dc:title>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseXMP([]byte(head + tt.body + tail))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseXMP() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != tt.want.Title || got.Description != tt.want.Description || got.Rating != tt.want.Rating ||
+				got.Label != tt.want.Label || !slices.Equal(got.Keywords, tt.want.Keywords) {
+				t.Errorf("parseXMP() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseXMPAlbumRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    XMPAlbumRule
+		wantErr bool
+	}{
+		{"keyword:beach", XMPAlbumRule{Keyword: "beach"}, false},
+		{"keyword:beach=Holidays", XMPAlbumRule{Keyword: "beach", Album: "Holidays"}, false},
+		{" Keyword : * ", XMPAlbumRule{Keyword: "*"}, false},
+		{"label:Red=Best of", XMPAlbumRule{Label: "Red", Album: "Best of"}, false},
+		{"beach", XMPAlbumRule{}, true},
+		{"keyword:", XMPAlbumRule{}, true},
+		{"keyword:=Album", XMPAlbumRule{}, true},
+		{"label:*", XMPAlbumRule{}, true},
+		{"rating:5=Best", XMPAlbumRule{}, true},
+		{"", XMPAlbumRule{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ParseXMPAlbumRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseXMPAlbumRule(%q) error = %v, want error %v", tt.rule, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseXMPAlbumRule(%q) = %+v, want %+v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}